@@ -0,0 +1,23 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+//go:embed openapi.yaml
+var Spec []byte
+
+// Load parses the embedded OpenAPI document and checks that it is valid.
+func Load(ctx context.Context) (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(Spec)
+	if err != nil {
+		return nil, err
+	}
+	if err = doc.Validate(ctx); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
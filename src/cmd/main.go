@@ -1,15 +1,25 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"yaa/api"
+	"yaa/internal/config"
 	"yaa/internal/handlers"
+	"yaa/internal/logging"
+	"yaa/internal/metrics"
 	"yaa/internal/repository"
 	"yaa/internal/services"
+	"yaa/migrations"
+	"yaa/pkg/migrate"
 	"yaa/pkg/postgres"
-
-	"golang.org/x/time/rate"
+	"yaa/pkg/ratelimit"
+	"yaa/pkg/tracing"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
@@ -19,39 +29,177 @@ func main() {
 
 	logger := logrus.New()
 
-	pool, err := postgres.NewPool(os.Getenv("POSTGRES_DSN"))
+	if err := run(logger); err != nil {
+		logger.Error(err)
+		os.Exit(1)
+	}
+}
+
+func run(logger *logrus.Logger) error {
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		return err
+	}
+	cfg.Log.Apply(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			logger.WithError(err).Warn("flush traces")
+		}
+	}()
+
+	pool, err := postgres.NewPool(cfg.Postgres.Pool())
 
 	if err != nil {
-		logger.Fatal(err)
+		return err
 	}
 	defer pool.Close()
 
-	repo := repository.NewRepository(pool, logger)
+	migrator, err := migrate.New(pool, migrations.FS, logger)
+	if err != nil {
+		return err
+	}
+
+	if len(args) > 0 && args[0] == "migrate" {
+		return runMigrate(ctx, migrator, args[1:])
+	}
+
+	err = migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+
+	repo := repository.NewRepository(pool, logger, cfg.TariffOverrides())
 	courierService := services.NewCouriersService(repo, logger)
 	orderService := services.NewOrderService(repo, logger)
+	assignmentService := services.NewAssignmentService(repo, logger)
+	importService := services.NewImportService(repo, orderService, logger, services.ImportOptions{
+		Workers:      cfg.Imports.Workers,
+		ChunkSize:    cfg.Imports.ChunkSize,
+		PollInterval: cfg.Imports.PollInterval,
+		Lease:        cfg.Imports.Lease,
+	})
+
+	spec, err := api.Load(ctx)
+	if err != nil {
+		return err
+	}
+	openAPIHandler, err := handlers.NewOpenAPI(logger, spec, cfg.OpenAPI.ValidateRequests, cfg.OpenAPI.ValidateResponses)
+	if err != nil {
+		return err
+	}
+
+	metrics.RegisterPool(pool)
 
 	r := mux.NewRouter()
+	r.NotFoundHandler = metrics.Unmatched(http.NotFoundHandler())
+	r.MethodNotAllowedHandler = metrics.Unmatched(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	r.Use(tracing.Middleware)
+	r.Use(logging.Middleware(logger))
+	r.Use(metrics.Middleware)
+
+	limiter := ratelimit.New(cfg.RateLimit)
+	limiter.Rejected = func(policy string) {
+		metrics.RateLimitRejections.WithLabelValues(policy).Inc()
+	}
+	go limiter.Run(ctx)
+	r.Use(limiter.Middleware)
 
-	limiter := rate.NewLimiter(1, 10)
-	r.Use(rateLimitMiddleware(limiter))
+	// Import files get their own, larger body limit.
+	imports := r.NewRoute().Subrouter()
+	imports.Use(handlers.LimitBody(logger, cfg.Imports.MaxFileBytes))
+	imports.Use(openAPIHandler.Middleware)
+
+	importHandler := handlers.NewImport(logger, importService)
+	importHandler.RegisterImportsRoutes(imports)
+	// Workers requeue their jobs on shutdown, so wait for them before the
+	// pool closes, on error returns as well.
+	workersCtx, stopWorkers := context.WithCancel(ctx)
+	workersDone := make(chan struct{})
+	go func() {
+		defer close(workersDone)
+		importService.Run(workersCtx)
+	}()
+	defer func() {
+		stopWorkers()
+		<-workersDone
+	}()
+
+	// Bulk imports are stored while they are read and may be larger too.
+	batches := r.NewRoute().Subrouter()
+	batches.Use(handlers.Deadline(logger, cfg.HTTP.BatchTimeout))
+	batches.Use(handlers.LimitBody(logger, cfg.HTTP.MaxBatchBytes))
+	batches.Use(openAPIHandler.Middleware)
 
 	courierHandler := handlers.NewCourier(logger, courierService)
-	courierHandler.RegisterCouriersRoutes(r)
+	courierHandler.RegisterCouriersBatchRoutes(batches)
 
 	orderHandler := handlers.NewOrder(logger, orderService)
-	orderHandler.RegisterOrdersRoutes(r)
+	orderHandler.RegisterOrdersBatchRoutes(batches)
 
-	log.Fatal(http.ListenAndServe(":8080", r))
-}
+	api := r.NewRoute().Subrouter()
+	api.Use(handlers.LimitBody(logger, cfg.HTTP.MaxBodyBytes))
+	api.Use(openAPIHandler.Middleware)
+
+	courierHandler.RegisterCouriersRoutes(api)
+	orderHandler.RegisterOrdersRoutes(api)
+
+	assignmentHandler := handlers.NewAssignment(logger, assignmentService)
+	assignmentHandler.RegisterAssignmentsRoutes(api)
 
-func rateLimitMiddleware(limiter *rate.Limiter) mux.MiddlewareFunc {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if limiter.Allow() == false {
-				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
-				return
-			}
-			next.ServeHTTP(w, r)
-		})
+	healthHandler := handlers.NewHealth(logger, pool, migrator)
+	healthHandler.RegisterHealthRoutes(api)
+
+	openAPIHandler.RegisterOpenAPIRoutes(api)
+
+	r.Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
+
+	srv := &http.Server{
+		Addr:              cfg.HTTP.Addr,
+		Handler:           r,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		logger.Infof("listening on %s", cfg.HTTP.Addr)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err = <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down, draining in-flight requests")
+	healthHandler.SetShuttingDown()
+	// Keep serving while load balancers notice /readyz failing.
+	time.Sleep(cfg.HTTP.DrainDelay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+
+	err = srv.Shutdown(shutdownCtx)
+	if err != nil {
+		return err
 	}
+	logger.Info("server stopped")
+	return nil
 }
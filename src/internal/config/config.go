@@ -0,0 +1,345 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+	"yaa/internal/domain"
+	"yaa/pkg/postgres"
+	"yaa/pkg/ratelimit"
+	"yaa/pkg/tracing"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	HTTP      HTTPConfig              `yaml:"http"`
+	Postgres  PostgresConfig          `yaml:"postgres"`
+	RateLimit ratelimit.Config        `yaml:"rate_limit"`
+	Log       LogConfig               `yaml:"log"`
+	Tracing   tracing.Config          `yaml:"tracing"`
+	OpenAPI   OpenAPIConfig           `yaml:"openapi"`
+	Imports   ImportsConfig           `yaml:"imports"`
+	Tariffs   map[string]TariffConfig `yaml:"tariffs"`
+}
+
+type HTTPConfig struct {
+	Addr              string        `yaml:"addr"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+	// DrainDelay is how long /readyz reports shutting down before the
+	// listener closes, so that load balancers stop routing to the instance.
+	DrainDelay   time.Duration `yaml:"drain_delay"`
+	MaxBodyBytes int64         `yaml:"max_body_bytes"`
+	// MaxBatchBytes limits the bodies of POST /couriers and POST /orders,
+	// which are read and stored a chunk at a time.
+	MaxBatchBytes int64 `yaml:"max_batch_bytes"`
+	// BatchTimeout bounds those imports from the first byte of the body to
+	// the response, in place of ReadTimeout and WriteTimeout. It must leave
+	// room for MaxBatchBytes at the slowest upload rate clients may have.
+	BatchTimeout time.Duration `yaml:"batch_timeout"`
+}
+
+type PostgresConfig struct {
+	DSN             string        `yaml:"dsn"`
+	Host            string        `yaml:"host"`
+	Port            int           `yaml:"port"`
+	Database        string        `yaml:"database"`
+	User            string        `yaml:"user"`
+	Password        string        `yaml:"password"`
+	MaxConns        int32         `yaml:"max_conns"`
+	MinConns        int32         `yaml:"min_conns"`
+	MaxConnLifetime time.Duration `yaml:"max_conn_lifetime"`
+	MaxConnIdleTime time.Duration `yaml:"max_conn_idle_time"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// OpenAPIConfig controls validation of traffic against api/openapi.yaml.
+// Response validation buffers every response and is meant for test setups.
+type OpenAPIConfig struct {
+	ValidateRequests  bool `yaml:"validate_requests"`
+	ValidateResponses bool `yaml:"validate_responses"`
+}
+
+// ImportsConfig sizes the background import of order files. A job not
+// heard from for Lease is taken over by another worker.
+type ImportsConfig struct {
+	Workers      int           `yaml:"workers"`
+	ChunkSize    int           `yaml:"chunk_size"`
+	MaxFileBytes int64         `yaml:"max_file_bytes"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	Lease        time.Duration `yaml:"lease"`
+}
+
+// TariffConfig overrides the coefficients stored in courier_type_profiles.
+type TariffConfig struct {
+	EarningsCoef float32 `yaml:"earnings_coef"`
+	RatingCoef   float32 `yaml:"rating_coef"`
+}
+
+func Default() Config {
+	return Config{
+		HTTP: HTTPConfig{
+			Addr:              ":8080",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+			DrainDelay:        5 * time.Second,
+			MaxBodyBytes:      10 << 20,
+			MaxBatchBytes:     100 << 20,
+			BatchTimeout:      5 * time.Minute,
+		},
+		Postgres: PostgresConfig{
+			Port:            5432,
+			MaxConns:        10,
+			MaxConnLifetime: time.Hour,
+			MaxConnIdleTime: 30 * time.Minute,
+		},
+		RateLimit: ratelimit.DefaultConfig(),
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Tracing: tracing.DefaultConfig(),
+		OpenAPI: OpenAPIConfig{
+			ValidateRequests: true,
+		},
+		Imports: ImportsConfig{
+			Workers:      2,
+			ChunkSize:    1000,
+			MaxFileBytes: 100 << 20,
+			PollInterval: 2 * time.Second,
+			Lease:        time.Minute,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the YAML file, environment
+// variables and command line flags, each overriding the previous one. It
+// returns the arguments left after flag parsing.
+func Load(args []string) (Config, []string, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("yaa", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "path to YAML config file")
+	addr := fs.String("http-addr", "", "HTTP listen address")
+	dsn := fs.String("postgres-dsn", "", "Postgres connection string")
+	level := fs.String("log-level", "", "log level")
+	format := fs.String("log-format", "", "log format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+
+	if *path != "" {
+		data, err := os.ReadFile(*path)
+		if err != nil {
+			return cfg, nil, err
+		}
+		if err = yaml.Unmarshal(data, &cfg); err != nil {
+			return cfg, nil, fmt.Errorf("parse %s: %w", *path, err)
+		}
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return cfg, nil, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "http-addr":
+			cfg.HTTP.Addr = *addr
+		case "postgres-dsn":
+			cfg.Postgres.DSN = *dsn
+		case "log-level":
+			cfg.Log.Level = *level
+		case "log-format":
+			cfg.Log.Format = *format
+		}
+	})
+
+	return cfg, fs.Args(), cfg.Validate()
+}
+
+func applyEnv(cfg *Config) error {
+	str := func(name string, dst *string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+	var err error
+	parse := func(name string, fn func(string) error) {
+		if v, ok := os.LookupEnv(name); ok && err == nil {
+			if perr := fn(v); perr != nil {
+				err = fmt.Errorf("%s: %w", name, perr)
+			}
+		}
+	}
+	duration := func(name string, dst *time.Duration) {
+		parse(name, func(v string) (e error) { *dst, e = time.ParseDuration(v); return })
+	}
+	int32Var := func(name string, dst *int32) {
+		parse(name, func(v string) error {
+			n, e := strconv.ParseInt(v, 10, 32)
+			*dst = int32(n)
+			return e
+		})
+	}
+
+	str("HTTP_ADDR", &cfg.HTTP.Addr)
+	duration("HTTP_READ_TIMEOUT", &cfg.HTTP.ReadTimeout)
+	duration("HTTP_READ_HEADER_TIMEOUT", &cfg.HTTP.ReadHeaderTimeout)
+	duration("HTTP_WRITE_TIMEOUT", &cfg.HTTP.WriteTimeout)
+	duration("HTTP_IDLE_TIMEOUT", &cfg.HTTP.IdleTimeout)
+	duration("HTTP_SHUTDOWN_TIMEOUT", &cfg.HTTP.ShutdownTimeout)
+	duration("HTTP_DRAIN_DELAY", &cfg.HTTP.DrainDelay)
+	parse("HTTP_MAX_BODY_BYTES", func(v string) (e error) { cfg.HTTP.MaxBodyBytes, e = strconv.ParseInt(v, 10, 64); return })
+	parse("HTTP_MAX_BATCH_BYTES", func(v string) (e error) { cfg.HTTP.MaxBatchBytes, e = strconv.ParseInt(v, 10, 64); return })
+	duration("HTTP_BATCH_TIMEOUT", &cfg.HTTP.BatchTimeout)
+
+	str("POSTGRES_DSN", &cfg.Postgres.DSN)
+	str("POSTGRES_SERVER", &cfg.Postgres.Host)
+	parse("POSTGRES_PORT", func(v string) (e error) { cfg.Postgres.Port, e = strconv.Atoi(v); return })
+	str("POSTGRES_DB", &cfg.Postgres.Database)
+	str("POSTGRES_USER", &cfg.Postgres.User)
+	str("POSTGRES_PASSWORD", &cfg.Postgres.Password)
+	int32Var("POSTGRES_MAX_CONNS", &cfg.Postgres.MaxConns)
+	int32Var("POSTGRES_MIN_CONNS", &cfg.Postgres.MinConns)
+
+	str("RATE_LIMIT_KEY", &cfg.RateLimit.Key)
+	parse("RATE_LIMIT_RATE", func(v string) (e error) { cfg.RateLimit.Default.Rate, e = strconv.ParseFloat(v, 64); return })
+	parse("RATE_LIMIT_BURST", func(v string) (e error) { cfg.RateLimit.Default.Burst, e = strconv.Atoi(v); return })
+	duration("RATE_LIMIT_IDLE_TTL", &cfg.RateLimit.IdleTTL)
+
+	str("LOG_LEVEL", &cfg.Log.Level)
+	str("LOG_FORMAT", &cfg.Log.Format)
+
+	str("TRACING_EXPORTER", &cfg.Tracing.Exporter)
+	str("OTEL_EXPORTER_OTLP_ENDPOINT", &cfg.Tracing.Endpoint)
+	parse("TRACING_INSECURE", func(v string) (e error) { cfg.Tracing.Insecure, e = strconv.ParseBool(v); return })
+	str("OTEL_SERVICE_NAME", &cfg.Tracing.ServiceName)
+	parse("TRACING_SAMPLE_RATIO", func(v string) (e error) { cfg.Tracing.SampleRatio, e = strconv.ParseFloat(v, 64); return })
+
+	parse("OPENAPI_VALIDATE_REQUESTS", func(v string) (e error) { cfg.OpenAPI.ValidateRequests, e = strconv.ParseBool(v); return })
+	parse("OPENAPI_VALIDATE_RESPONSES", func(v string) (e error) { cfg.OpenAPI.ValidateResponses, e = strconv.ParseBool(v); return })
+
+	parse("IMPORTS_WORKERS", func(v string) (e error) { cfg.Imports.Workers, e = strconv.Atoi(v); return })
+	parse("IMPORTS_CHUNK_SIZE", func(v string) (e error) { cfg.Imports.ChunkSize, e = strconv.Atoi(v); return })
+	parse("IMPORTS_MAX_FILE_BYTES", func(v string) (e error) { cfg.Imports.MaxFileBytes, e = strconv.ParseInt(v, 10, 64); return })
+	duration("IMPORTS_POLL_INTERVAL", &cfg.Imports.PollInterval)
+	duration("IMPORTS_LEASE", &cfg.Imports.Lease)
+
+	return err
+}
+
+func (c Config) Validate() error {
+	if c.HTTP.Addr == "" {
+		return fmt.Errorf("http.addr is required")
+	}
+	if c.HTTP.ReadTimeout <= 0 || c.HTTP.ReadHeaderTimeout <= 0 || c.HTTP.WriteTimeout <= 0 ||
+		c.HTTP.IdleTimeout <= 0 || c.HTTP.ShutdownTimeout <= 0 {
+		return fmt.Errorf("http timeouts must be positive")
+	}
+	if c.HTTP.DrainDelay < 0 {
+		return fmt.Errorf("http.drain_delay must not be negative")
+	}
+	if c.HTTP.MaxBodyBytes <= 0 {
+		return fmt.Errorf("http.max_body_bytes must be positive")
+	}
+	if c.HTTP.MaxBatchBytes <= 0 {
+		return fmt.Errorf("http.max_batch_bytes must be positive")
+	}
+	if c.HTTP.BatchTimeout < c.HTTP.ReadTimeout || c.HTTP.BatchTimeout < c.HTTP.WriteTimeout {
+		return fmt.Errorf("http.batch_timeout must be at least read_timeout and write_timeout")
+	}
+
+	if c.Postgres.DSN == "" && c.Postgres.Host == "" {
+		return fmt.Errorf("postgres.dsn or postgres.host is required")
+	}
+	if c.Postgres.MaxConns <= 0 || c.Postgres.MinConns < 0 || c.Postgres.MinConns > c.Postgres.MaxConns {
+		return fmt.Errorf("postgres pool requires 0 <= min_conns <= max_conns and max_conns > 0")
+	}
+
+	if _, err := logrus.ParseLevel(c.Log.Level); err != nil {
+		return fmt.Errorf("log.level: %w", err)
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		return fmt.Errorf("log.format must be text or json, got %q", c.Log.Format)
+	}
+
+	if err := c.RateLimit.Validate(); err != nil {
+		return err
+	}
+	if err := c.Tracing.Validate(); err != nil {
+		return err
+	}
+
+	if c.Imports.Workers <= 0 || c.Imports.ChunkSize <= 0 || c.Imports.MaxFileBytes <= 0 {
+		return fmt.Errorf("imports.workers, chunk_size and max_file_bytes must be positive")
+	}
+	if c.Imports.PollInterval <= 0 || c.Imports.Lease <= 0 {
+		return fmt.Errorf("imports.poll_interval and lease must be positive")
+	}
+
+	for t, tariff := range c.Tariffs {
+		if t != "FOOT" && t != "BIKE" && t != "AUTO" {
+			return fmt.Errorf("tariffs: unknown courier type %q", t)
+		}
+		if tariff.EarningsCoef <= 0 || tariff.RatingCoef <= 0 {
+			return fmt.Errorf("tariffs.%s: coefficients must be positive", t)
+		}
+	}
+	return nil
+}
+
+func (p PostgresConfig) ConnString() string {
+	if p.DSN != "" {
+		return p.DSN
+	}
+	u := url.URL{
+		Scheme: "postgresql",
+		User:   url.UserPassword(p.User, p.Password),
+		Host:   net.JoinHostPort(p.Host, strconv.Itoa(p.Port)),
+		Path:   "/" + p.Database,
+	}
+	return u.String()
+}
+
+func (p PostgresConfig) Pool() postgres.Config {
+	return postgres.Config{
+		DSN:             p.ConnString(),
+		MaxConns:        p.MaxConns,
+		MinConns:        p.MinConns,
+		MaxConnLifetime: p.MaxConnLifetime,
+		MaxConnIdleTime: p.MaxConnIdleTime,
+	}
+}
+
+func (c Config) TariffOverrides() map[string]domain.Tariff {
+	res := make(map[string]domain.Tariff, len(c.Tariffs))
+	for t, tariff := range c.Tariffs {
+		res[t] = domain.Tariff{EarningsCoef: tariff.EarningsCoef, RatingCoef: tariff.RatingCoef}
+	}
+	return res
+}
+
+func (l LogConfig) Apply(logger *logrus.Logger) {
+	level, _ := logrus.ParseLevel(l.Level)
+	logger.SetLevel(level)
+	if l.Format == "json" {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	}
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+http:
+  addr: ":7000"
+  read_header_timeout: 7s
+postgres:
+  host: db
+log:
+  level: warn
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		file       bool
+		env        map[string]string
+		flags      []string
+		addr       string
+		level      string
+		readHeader time.Duration
+	}{
+		{
+			name:       "defaults",
+			env:        map[string]string{"POSTGRES_SERVER": "db"},
+			addr:       ":8080",
+			level:      "info",
+			readHeader: 5 * time.Second,
+		},
+		{
+			name:       "file over defaults",
+			file:       true,
+			addr:       ":7000",
+			level:      "warn",
+			readHeader: 7 * time.Second,
+		},
+		{
+			name:       "env over file",
+			file:       true,
+			env:        map[string]string{"HTTP_ADDR": ":7001", "HTTP_READ_HEADER_TIMEOUT": "9s"},
+			addr:       ":7001",
+			level:      "warn",
+			readHeader: 9 * time.Second,
+		},
+		{
+			name:       "flags over env",
+			file:       true,
+			env:        map[string]string{"HTTP_ADDR": ":7001", "LOG_LEVEL": "error"},
+			flags:      []string{"-http-addr", ":7002", "-log-level", "debug"},
+			addr:       ":7002",
+			level:      "debug",
+			readHeader: 7 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.flags
+			if tt.file {
+				args = append([]string{"-config", path}, args...)
+			}
+			cfg, rest, err := Load(append(args, "migrate"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rest) != 1 || rest[0] != "migrate" {
+				t.Errorf("remaining args %v, want [migrate]", rest)
+			}
+			if cfg.HTTP.Addr != tt.addr {
+				t.Errorf("addr %q, want %q", cfg.HTTP.Addr, tt.addr)
+			}
+			if cfg.Log.Level != tt.level {
+				t.Errorf("log level %q, want %q", cfg.Log.Level, tt.level)
+			}
+			if cfg.HTTP.ReadHeaderTimeout != tt.readHeader {
+				t.Errorf("read header timeout %v, want %v", cfg.HTTP.ReadHeaderTimeout, tt.readHeader)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsBadEnv(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("POSTGRES_SERVER", "db")
+	t.Setenv("HTTP_READ_HEADER_TIMEOUT", "soon")
+	if _, _, err := Load(nil); err == nil {
+		t.Fatal("Load accepted HTTP_READ_HEADER_TIMEOUT=soon")
+	}
+}
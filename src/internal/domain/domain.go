@@ -1,29 +1,76 @@
 package domain
 
+import "time"
+
 type Courier struct {
-	Id        int64    `json:"id"`
-	Type      string   `json:"type"`
-	Regions   []int32  `json:"regions"`
-	WorkHours []string `json:"working_hours"`
+	Id            int64          `json:"id"`
+	Type          string         `json:"type"`
+	Regions       []int32        `json:"regions"`
+	WorkHours     []TimeInterval `json:"working_hours"`
+	DeactivatedAt *time.Time     `json:"deactivated_at,omitempty"`
+	Version       int64          `json:"-"`
+}
+
+// CourierPatch is the body of PATCH /couriers/{courier_id}; nil fields are
+// left unchanged. A type change applies to orders completed from
+// EffectiveFrom on, which defaults to the time of the request.
+type CourierPatch struct {
+	Type          *string         `json:"type"`
+	Regions       *[]int32        `json:"regions"`
+	WorkHours     *[]TimeInterval `json:"working_hours"`
+	EffectiveFrom *time.Time      `json:"effective_from"`
+}
+
+// VersionMatch is the If-Match condition of a courier change: any current
+// version, or one of Versions.
+type VersionMatch struct {
+	Any      bool
+	Versions []int64
+}
+
+func (m VersionMatch) Matches(version int64) bool {
+	if m.Any {
+		return true
+	}
+	for _, v := range m.Versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
 }
 
 type Order struct {
-	Id         int64    `json:"id"`
-	DelivHours []string `json:"delivery_hours"`
-	Cost       int32    `json:"cost"`
-	Regions    int32    `json:"regions"`
-	Weight     float32  `json:"weight"`
+	Id            int64          `json:"id"`
+	DelivHours    []TimeInterval `json:"delivery_hours"`
+	Cost          int32          `json:"cost"`
+	Regions       int32          `json:"regions"`
+	Weight        float32        `json:"weight"`
+	CompletedTime *time.Time     `json:"completed_time,omitempty"`
+	Status        OrderStatus    `json:"status,omitempty"`
+	CourierID     *int64         `json:"courier_id,omitempty"`
 }
 
 type CompleteOrder struct {
-	IdCourier    int64  `json:"courier_id"`
-	IdOrder      int64  `json:"order_id"`
-	CompleteTime string `json:"completed_time"`
+	IdCourier    int64     `json:"courier_id"`
+	IdOrder      int64     `json:"order_id"`
+	CompleteTime time.Time `json:"completed_time"`
 }
 
-type Rating struct {
-	Earn       float32
-	CourRating float32
+type CourierMeta struct {
+	Courier
+	Earnings           *float32      `json:"earnings,omitempty"`
+	Rating             *float32      `json:"rating,omitempty"`
+	CompletedOrders    int64         `json:"completed_orders"`
+	AvgDeliveryMinutes *float64      `json:"avg_delivery_minutes,omitempty"`
+	RegionBreakdown    []RegionStats `json:"region_breakdown"`
+}
+
+type RegionStats struct {
+	Region    int32   `json:"region"`
+	Completed int64   `json:"completed_orders"`
+	TotalCost int64   `json:"-"`
+	Earnings  float32 `json:"earnings"`
 }
 
 type CourierSl struct {
@@ -37,3 +84,64 @@ type OrderSl struct {
 type ComplOrderSl struct {
 	CompOrd []CompleteOrder `json:"complete_orders"`
 }
+
+type DeliveryGroup struct {
+	Id         int64     `json:"group_order_id"`
+	Orders     []int64   `json:"orders"`
+	StartTime  time.Time `json:"start_time"`
+	FinishTime time.Time `json:"finish_time"`
+	Cost       int32     `json:"cost"`
+}
+
+type CourierAssignment struct {
+	IdCourier int64           `json:"courier_id"`
+	Groups    []DeliveryGroup `json:"orders"`
+}
+
+type AssignmentSl struct {
+	Date     string              `json:"date"`
+	Couriers []CourierAssignment `json:"couriers"`
+}
+
+type CourierTypeProfile struct {
+	Type              string  `json:"type"`
+	MaxWeight         float32 `json:"max_weight"`
+	MaxOrders         int     `json:"max_orders"`
+	MaxRegions        int     `json:"max_regions"`
+	FirstOrderMinutes int     `json:"first_order_minutes"`
+	NextOrderMinutes  int     `json:"next_order_minutes"`
+	EarningsCoef      float32 `json:"earnings_coef"`
+	RatingCoef        float32 `json:"rating_coef"`
+}
+
+type Tariff struct {
+	EarningsCoef float32 `json:"earnings_coef"`
+	RatingCoef   float32 `json:"rating_coef"`
+}
+
+type CourierStats struct {
+	Completed          int64             `json:"completed"`
+	TotalCost          int64             `json:"total_cost"`
+	AvgDeliveryMinutes *float64          `json:"avg_delivery_minutes"`
+	Breakdown          []TypeRegionStats `json:"breakdown"`
+}
+
+// TypeRegionStats groups completed orders by region and by the courier type
+// in effect at completion time.
+type TypeRegionStats struct {
+	Region    int32  `json:"region"`
+	Type      string `json:"type"`
+	Completed int64  `json:"completed"`
+	TotalCost int64  `json:"total_cost"`
+}
+
+func (p CourierTypeProfile) Earnings(totalCost int64) float32 {
+	return float32(totalCost) * p.EarningsCoef
+}
+
+func (p CourierTypeProfile) Rating(completed int64, hours float64) float32 {
+	if hours <= 0 {
+		return 0
+	}
+	return float32(float64(completed)/hours) * p.RatingCoef
+}
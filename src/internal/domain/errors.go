@@ -0,0 +1,12 @@
+package domain
+
+import "errors"
+
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrValidation = errors.New("validation failed")
+
+	// ErrPreconditionFailed means the caller's version of a resource is stale.
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
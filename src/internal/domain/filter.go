@@ -0,0 +1,27 @@
+package domain
+
+import "time"
+
+// CourierFilter narrows GET /couriers; zero fields do not filter.
+// Deactivated couriers are only listed with IncludeInactive.
+type CourierFilter struct {
+	Type            string
+	Region          *int32
+	WorkingHours    *TimeInterval
+	IncludeInactive bool
+}
+
+// OrderFilter narrows GET /orders; zero fields do not filter. The completed
+// time range is half-open: [CompletedFrom, CompletedTo).
+type OrderFilter struct {
+	Region        *int32
+	Completed     *bool
+	Status        OrderStatus
+	MinWeight     *float32
+	MaxWeight     *float32
+	MinCost       *int32
+	MaxCost       *int32
+	DeliveryHours *TimeInterval
+	CompletedFrom *time.Time
+	CompletedTo   *time.Time
+}
@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// ImportMode decides what a bulk import does with ids that already exist.
+type ImportMode string
+
+const (
+	// ImportStrict rejects the whole batch if any id exists.
+	ImportStrict ImportMode = "strict"
+	// ImportSkipExisting leaves existing rows untouched.
+	ImportSkipExisting ImportMode = "skip_existing"
+	// ImportUpsert overwrites existing rows that may still change: active
+	// couriers and orders that are not assigned yet.
+	ImportUpsert ImportMode = "upsert"
+)
+
+func (m ImportMode) Valid() bool {
+	switch m {
+	case ImportStrict, ImportSkipExisting, ImportUpsert:
+		return true
+	}
+	return false
+}
+
+type ImportResult struct {
+	Created []int64 `json:"created"`
+	Updated []int64 `json:"updated"`
+	Skipped []int64 `json:"skipped"`
+}
+
+func NewImportResult() ImportResult {
+	return ImportResult{Created: []int64{}, Updated: []int64{}, Skipped: []int64{}}
+}
+
+// CourierFeed and OrderFeed hand a bulk import to flush a chunk at a time.
+// flush must not keep chunk after it returns, and the feed stops at its
+// first error.
+type (
+	CourierFeed func(flush func(chunk []Courier) error) error
+	OrderFeed   func(flush func(chunk []Order) error) error
+)
+
+// DuplicateError lists the items of a strict import whose ids already exist.
+type DuplicateError struct {
+	Index []int
+	IDs   []int64
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("ids already exist: %v", e.IDs)
+}
+
+func (e *DuplicateError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// Formats accepted for import files.
+const (
+	ImportJSON   = "json"
+	ImportNDJSON = "ndjson"
+	ImportCSV    = "csv"
+)
+
+type ImportJobStatus string
+
+const (
+	JobQueued    ImportJobStatus = "queued"
+	JobRunning   ImportJobStatus = "running"
+	JobSucceeded ImportJobStatus = "succeeded"
+	JobFailed    ImportJobStatus = "failed"
+)
+
+// ImportJob is an order file imported in the background. Rows that cannot be
+// imported are counted in Failed and the first of them listed in Errors; the
+// rest of the file is still imported.
+type ImportJob struct {
+	Id            int64           `json:"id"`
+	Format        string          `json:"format"`
+	Mode          ImportMode      `json:"mode"`
+	Status        ImportJobStatus `json:"status"`
+	Attempts      int             `json:"attempts"`
+	TotalRows     *int            `json:"total_rows,omitempty"`
+	ProcessedRows int             `json:"processed_rows"`
+	Created       int             `json:"created"`
+	Updated       int             `json:"updated"`
+	Skipped       int             `json:"skipped"`
+	Failed        int             `json:"failed"`
+	Errors        []RowError      `json:"errors"`
+	Error         string          `json:"error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	StartedAt     *time.Time      `json:"started_at,omitempty"`
+	FinishedAt    *time.Time      `json:"finished_at,omitempty"`
+}
+
+// RowError points at a row of an import file: the element number for JSON,
+// the line number for NDJSON and CSV.
+type RowError struct {
+	Row     int    `json:"row"`
+	Id      int64  `json:"id,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,124 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const minutesPerDay = 24 * 60
+
+// TimeInterval is a daily window in minutes since midnight, formatted as
+// "HH:MM-HH:MM". An End earlier than Start means the window crosses midnight.
+type TimeInterval struct {
+	Start int
+	End   int
+
+	// invalid says why the JSON value could not be parsed; see Err.
+	invalid string
+}
+
+func ParseTimeInterval(s string) (TimeInterval, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return TimeInterval{}, fmt.Errorf("%q is not in HH:MM-HH:MM format", s)
+	}
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return TimeInterval{}, fmt.Errorf("%q is not in HH:MM-HH:MM format", s)
+	}
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return TimeInterval{}, fmt.Errorf("%q is not in HH:MM-HH:MM format", s)
+	}
+	if start == end {
+		return TimeInterval{}, fmt.Errorf("%q is empty", s)
+	}
+	return TimeInterval{Start: start, End: end}, nil
+}
+
+func parseClock(s string) (int, error) {
+	if len(s) != len("15:04") {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (i TimeInterval) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", i.Start/60, i.Start%60, i.End/60, i.End%60)
+}
+
+func (i TimeInterval) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.String())
+}
+
+// UnmarshalJSON accepts any value and leaves reporting a malformed one to
+// validation through Err, so that a bad interval is tied to the item and
+// field it came from instead of failing the whole body.
+func (i *TimeInterval) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		*i = TimeInterval{invalid: fmt.Sprintf("%s is not a string", data)}
+		return nil
+	}
+	parsed, err := ParseTimeInterval(s)
+	if err != nil {
+		*i = TimeInterval{invalid: err.Error()}
+		return nil
+	}
+	*i = parsed
+	return nil
+}
+
+// Err reports a value that UnmarshalJSON could not parse.
+func (i TimeInterval) Err() error {
+	if i.invalid == "" {
+		return nil
+	}
+	return errors.New(i.invalid)
+}
+
+func (i TimeInterval) CrossesMidnight() bool {
+	return i.End < i.Start
+}
+
+// Bounds returns the window as a linear [lo, hi] range of minutes, with hi
+// past 24:00 for windows that cross midnight.
+func (i TimeInterval) Bounds() (int, int) {
+	if i.CrossesMidnight() {
+		return i.Start, i.End + minutesPerDay
+	}
+	return i.Start, i.End
+}
+
+func (i TimeInterval) Duration() time.Duration {
+	lo, hi := i.Bounds()
+	return time.Duration(hi-lo) * time.Minute
+}
+
+// Contains reports whether the minute of day m falls inside the window,
+// both ends inclusive.
+func (i TimeInterval) Contains(m int) bool {
+	m = ((m % minutesPerDay) + minutesPerDay) % minutesPerDay
+	if i.CrossesMidnight() {
+		return m >= i.Start || m <= i.End
+	}
+	return m >= i.Start && m <= i.End
+}
+
+func (i TimeInterval) Overlaps(o TimeInterval) bool {
+	lo, hi := i.Bounds()
+	olo, ohi := o.Bounds()
+	for _, shift := range []int{-minutesPerDay, 0, minutesPerDay} {
+		if lo < ohi+shift && olo+shift < hi {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package domain
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+
+	cursorPrefix = "id:"
+
+	SortByID = "id"
+)
+
+// PageRequest selects a page either by Offset or, when ByCursor is set, by
+// keyset on id: only rows with id after After in the sort direction are
+// returned. Cursor mode therefore requires Sort to be "id".
+type PageRequest struct {
+	Limit     int
+	Offset    int
+	After     int64
+	ByCursor  bool
+	WithTotal bool
+	Sort      string
+	Desc      bool
+}
+
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	Offset     *int   `json:"offset,omitempty"`
+	Cursor     string `json:"cursor,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	NextOffset *int   `json:"next_offset,omitempty"`
+	Total      *int64 `json:"total,omitempty"`
+}
+
+type CourierPage struct {
+	Couriers []Courier `json:"couriers"`
+	Pagination
+}
+
+type OrderPage struct {
+	Orders []Order `json:"orders"`
+	Pagination
+}
+
+// NewPagination describes the page requested by p. lastID and more tell
+// whether there is a next page and where it starts. Cursors only work on the
+// id order, so pages sorted by anything else point to the next offset.
+func NewPagination(p PageRequest, lastID int64, more bool) Pagination {
+	res := Pagination{Limit: p.Limit}
+	if p.ByCursor {
+		res.Cursor = EncodeCursor(p.After)
+	} else {
+		offset := p.Offset
+		res.Offset = &offset
+	}
+	if !more {
+		return res
+	}
+	if p.Sort == "" || p.Sort == SortByID {
+		res.NextCursor = EncodeCursor(lastID)
+	} else {
+		next := p.Offset + p.Limit
+		res.NextOffset = &next
+	}
+	return res
+}
+
+// EncodeCursor returns an opaque token pointing right after the given id.
+func EncodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.FormatInt(id, 10)))
+}
+
+func DecodeCursor(s string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || !strings.HasPrefix(string(raw), cursorPrefix) {
+		return 0, fmt.Errorf("malformed cursor %q: %w", s, ErrValidation)
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(string(raw), cursorPrefix), 10, 64)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("malformed cursor %q: %w", s, ErrValidation)
+	}
+	return id, nil
+}
@@ -0,0 +1,41 @@
+package domain
+
+import "testing"
+
+func TestNewPaginationNextPage(t *testing.T) {
+	tests := []struct {
+		name       string
+		p          PageRequest
+		more       bool
+		wantCursor bool
+		wantOffset *int
+	}{
+		{name: "default sort", p: PageRequest{Limit: 10}, more: true, wantCursor: true},
+		{name: "by id descending", p: PageRequest{Limit: 10, Sort: SortByID, Desc: true}, more: true, wantCursor: true},
+		{name: "cursor mode", p: PageRequest{Limit: 10, ByCursor: true, After: 5}, more: true, wantCursor: true},
+		{name: "by cost", p: PageRequest{Limit: 10, Offset: 20, Sort: "cost"}, more: true, wantOffset: intPtr(30)},
+		{name: "last page by id", p: PageRequest{Limit: 10}},
+		{name: "last page by cost", p: PageRequest{Limit: 10, Sort: "cost"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := NewPagination(tt.p, 42, tt.more)
+			if got := res.NextCursor != ""; got != tt.wantCursor {
+				t.Errorf("next_cursor %q, want set: %v", res.NextCursor, tt.wantCursor)
+			}
+			if tt.wantCursor {
+				if id, err := DecodeCursor(res.NextCursor); err != nil || id != 42 {
+					t.Errorf("next_cursor decodes to %d, %v; want 42", id, err)
+				}
+			}
+			switch {
+			case tt.wantOffset == nil && res.NextOffset != nil:
+				t.Errorf("next_offset %d, want none", *res.NextOffset)
+			case tt.wantOffset != nil && (res.NextOffset == nil || *res.NextOffset != *tt.wantOffset):
+				t.Errorf("next_offset %v, want %d", res.NextOffset, *tt.wantOffset)
+			}
+		})
+	}
+}
+
+func intPtr(n int) *int { return &n }
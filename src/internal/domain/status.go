@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+type OrderStatus string
+
+const (
+	OrderCreated    OrderStatus = "created"
+	OrderAssigned   OrderStatus = "assigned"
+	OrderInDelivery OrderStatus = "in_delivery"
+	OrderCompleted  OrderStatus = "completed"
+	OrderCancelled  OrderStatus = "cancelled"
+	OrderFailed     OrderStatus = "failed"
+)
+
+// Actors recorded in the status history.
+const (
+	ActorClient     = "client"
+	ActorCourier    = "courier"
+	ActorDispatcher = "dispatcher"
+	ActorSystem     = "system"
+)
+
+// orderTransitions lists the statuses each status may move to. Completed and
+// cancelled orders are final.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderCreated:    {OrderAssigned, OrderCancelled},
+	OrderAssigned:   {OrderInDelivery, OrderCompleted, OrderCreated, OrderCancelled},
+	OrderInDelivery: {OrderCompleted, OrderFailed},
+	OrderFailed:     {OrderCreated, OrderCancelled},
+}
+
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case OrderCreated, OrderAssigned, OrderInDelivery, OrderCompleted, OrderCancelled, OrderFailed:
+		return true
+	}
+	return false
+}
+
+// CheckTransition returns an ErrConflict error unless an order may move from
+// s to next.
+func (s OrderStatus) CheckTransition(next OrderStatus) error {
+	for _, to := range orderTransitions[s] {
+		if to == next {
+			return nil
+		}
+	}
+	return fmt.Errorf("order cannot go from %s to %s: %w", s, next, ErrConflict)
+}
+
+// OrderTransition moves an order from From to To. The repository applies it
+// only if the order still has status From. CompletedTime is required when To
+// is OrderCompleted.
+type OrderTransition struct {
+	OrderID       int64
+	From          OrderStatus
+	To            OrderStatus
+	Actor         string
+	CourierID     *int64
+	CompletedTime *time.Time
+}
+
+// OrderAction is the body of courier-driven order operations.
+type OrderAction struct {
+	IdCourier int64 `json:"courier_id"`
+}
+
+// OrderCancel is the body of POST /orders/{order_id}/cancel.
+type OrderCancel struct {
+	Actor string `json:"actor"`
+}
+
+// OrderReassign is the body of POST /orders/{order_id}/reassign. Without
+// IdCourier the order goes back to the pool for the next assignment run.
+type OrderReassign struct {
+	Actor     string `json:"actor"`
+	IdCourier *int64 `json:"courier_id"`
+}
+
+type OrderStatusChange struct {
+	From      *OrderStatus `json:"from,omitempty"`
+	To        OrderStatus  `json:"to"`
+	Actor     string       `json:"actor"`
+	CourierID *int64       `json:"courier_id,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	ChangedAt time.Time    `json:"changed_at"`
+}
+
+type OrderHistory struct {
+	IdOrder int64               `json:"order_id"`
+	Changes []OrderStatusChange `json:"history"`
+}
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckTransition(t *testing.T) {
+	all := []OrderStatus{OrderCreated, OrderAssigned, OrderInDelivery, OrderCompleted, OrderCancelled, OrderFailed}
+	tests := []struct {
+		from    OrderStatus
+		allowed []OrderStatus
+	}{
+		{OrderCreated, []OrderStatus{OrderAssigned, OrderCancelled}},
+		{OrderAssigned, []OrderStatus{OrderInDelivery, OrderCompleted, OrderCreated, OrderCancelled}},
+		{OrderInDelivery, []OrderStatus{OrderCompleted, OrderFailed}},
+		{OrderFailed, []OrderStatus{OrderCreated, OrderCancelled}},
+		{OrderCompleted, nil},
+		{OrderCancelled, nil},
+	}
+	for _, tt := range tests {
+		allowed := make(map[OrderStatus]bool)
+		for _, to := range tt.allowed {
+			allowed[to] = true
+		}
+		for _, to := range all {
+			err := tt.from.CheckTransition(to)
+			if allowed[to] && err != nil {
+				t.Errorf("%s -> %s: %v, want allowed", tt.from, to, err)
+			}
+			if !allowed[to] && !errors.Is(err, ErrConflict) {
+				t.Errorf("%s -> %s: %v, want ErrConflict", tt.from, to, err)
+			}
+		}
+	}
+	if len(orderTransitions) != len(tests)-2 {
+		t.Errorf("orderTransitions has %d source statuses, the table covers %d", len(orderTransitions), len(tests)-2)
+	}
+}
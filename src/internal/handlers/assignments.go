@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+	"yaa/internal/domain"
+	"yaa/internal/validation"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type AssignmentsService interface {
+	AssignOrders(ctx context.Context, date time.Time) (domain.AssignmentSl, error)
+}
+
+type Assignments struct {
+	service AssignmentsService
+	logger  logrus.FieldLogger
+}
+
+func NewAssignment(logger logrus.FieldLogger, service AssignmentsService) *Assignments {
+	return &Assignments{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (c *Assignments) RegisterAssignmentsRoutes(r *mux.Router) {
+	r.HandleFunc("/orders/assign", c.AssignOrders).Methods(http.MethodPost)
+}
+
+func (c *Assignments) AssignOrders(w http.ResponseWriter, r *http.Request) {
+	date := time.Now().UTC()
+	if dateStr := r.URL.Query().Get("date"); dateStr != "" {
+		var err error
+		date, err = time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			writeError(w, r, c.logger, validation.Invalid("invalid date %q, expected YYYY-MM-DD", dateStr))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	result, err := c.service.AssignOrders(ctx, date)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
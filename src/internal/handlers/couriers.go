@@ -3,9 +3,13 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 	"yaa/internal/domain"
+	"yaa/internal/validation"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
@@ -13,11 +17,16 @@ import (
 
 type CouriersService interface {
 	GetCourier(ctx context.Context, id int64) (*domain.Courier, error)
-	GetCouriers(ctx context.Context, o, l int) ([]domain.Courier, error)
-	AddCouriers(ctx context.Context, couriers domain.CourierSl) error
-	CouriersMeta(ctx context.Context, start, end string, courID int64) (error, domain.Rating)
+	GetCouriers(ctx context.Context, f domain.CourierFilter, p domain.PageRequest) (domain.CourierPage, error)
+	AddCouriers(ctx context.Context, feed domain.CourierFeed, mode domain.ImportMode) (domain.ImportResult, error)
+	CouriersMeta(ctx context.Context, start, end string, courID int64) (domain.CourierMeta, error)
+	GetAssignments(ctx context.Context, date time.Time, courID int64) (domain.AssignmentSl, error)
+	UpdateCourier(ctx context.Context, id int64, match domain.VersionMatch, patch domain.CourierPatch) (*domain.Courier, error)
+	DeactivateCourier(ctx context.Context, id int64, match domain.VersionMatch) error
 }
 
+var errPreconditionRequired = errors.New("If-Match header with the courier's ETag is required")
+
 type Couriers struct {
 	service CouriersService
 	logger  logrus.FieldLogger
@@ -31,61 +40,117 @@ func NewCourier(logger logrus.FieldLogger, service CouriersService) *Couriers {
 }
 
 func (c *Couriers) RegisterCouriersRoutes(r *mux.Router) {
-	r.HandleFunc("/couriers/{courier_id}", c.GetCourier).Methods(http.MethodGet)
+	r.HandleFunc("/couriers/assignments", c.GetAssignments).Methods(http.MethodGet)
+	r.HandleFunc("/couriers/{courier_id:[0-9]+}", c.GetCourier).Methods(http.MethodGet)
+	r.HandleFunc("/couriers/{courier_id:[0-9]+}", c.UpdateCourier).Methods(http.MethodPatch)
+	r.HandleFunc("/couriers/{courier_id:[0-9]+}", c.DeactivateCourier).Methods(http.MethodDelete)
 	r.HandleFunc("/couriers", c.GetCouriers).Methods(http.MethodGet)
-	r.HandleFunc("/couriers", c.AddCouriers).Methods(http.MethodPost)
 	r.HandleFunc("/couriers/meta-info/{courier_id}", c.CouriersMeta).Methods(http.MethodGet)
 }
 
+// RegisterCouriersBatchRoutes registers the bulk import, which gets a larger
+// body limit than the other routes.
+func (c *Couriers) RegisterCouriersBatchRoutes(r *mux.Router) {
+	r.HandleFunc("/couriers", c.AddCouriers).Methods(http.MethodPost)
+}
+
 func (c *Couriers) GetCourier(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseInt(vars["courier_id"], 10, 64)
 	if err != nil {
-		c.logger.Error("Error converting id to int: %v\n", err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, c.logger, validation.Invalid("invalid courier_id %q", vars["courier_id"]))
 		return
 	}
 
 	ctx := r.Context()
 	user, err := c.service.GetCourier(ctx, id)
 	if err != nil {
-		c.logger.Error("Error getting user: %v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, c.logger, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(user.Version))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(user)
 }
 
-func (c *Couriers) GetCouriers(w http.ResponseWriter, r *http.Request) {
-	offset, limit := 0, 1
-	offsetStr := r.URL.Query().Get("offset")
-	limitStr := r.URL.Query().Get("limit")
+func (c *Couriers) UpdateCourier(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["courier_id"], 10, 64)
+	if err != nil {
+		writeError(w, r, c.logger, validation.Invalid("invalid courier_id %q", vars["courier_id"]))
+		return
+	}
+	match, err := ifMatch(r)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
 
-	if offsetStr != "" {
-		var err error
-		offset, err = strconv.Atoi(offsetStr)
-		if err != nil {
-			c.logger.Error("Error convert offset: %v\n", err)
-			return
-		}
+	var patch domain.CourierPatch
+	err = decodeBody(r, &patch)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+	err = validation.CourierPatch(patch)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
 	}
 
-	if limitStr != "" {
-		var err error
-		limit, err = strconv.Atoi(limitStr)
-		if err != nil {
-			c.logger.Error("Error convert limit: %v\n", err)
-			return
-		}
+	ctx := r.Context()
+	courier, err := c.service.UpdateCourier(ctx, id, match, patch)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(courier.Version))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(courier)
+}
+
+func (c *Couriers) DeactivateCourier(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["courier_id"], 10, 64)
+	if err != nil {
+		writeError(w, r, c.logger, validation.Invalid("invalid courier_id %q", vars["courier_id"]))
+		return
+	}
+	match, err := ifMatch(r)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
 	}
 
 	ctx := r.Context()
-	couriers, err := c.service.GetCouriers(ctx, offset, limit)
+	err = c.service.DeactivateCourier(ctx, id, match)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, c.logger, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Couriers) GetCouriers(w http.ResponseWriter, r *http.Request) {
+	page, err := parsePage(r)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+	filter, err := parseCourierFilter(r)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+
+	ctx := r.Context()
+	couriers, err := c.service.GetCouriers(ctx, filter, page)
+	if err != nil {
+		writeError(w, r, c.logger, err)
 		return
 	}
 
@@ -94,19 +159,25 @@ func (c *Couriers) GetCouriers(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(couriers)
 }
 
+// AddCouriers stores the couriers of the body in one transaction, a chunk at
+// a time as they are read.
 func (c *Couriers) AddCouriers(w http.ResponseWriter, r *http.Request) {
-	var CourSl domain.CourierSl
-	err := json.NewDecoder(r.Body).Decode(&CourSl)
+	mode, err := parseImportMode(r)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, c.logger, err)
 		return
 	}
 
 	ctx := r.Context()
-	err = c.service.AddCouriers(ctx, CourSl)
+	res, err := c.service.AddCouriers(ctx, batchFeed(r, "couriers", (*validation.Batch).Couriers), mode)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, c.logger, err)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
 }
 
 func (c *Couriers) CouriersMeta(w http.ResponseWriter, r *http.Request) {
@@ -114,17 +185,92 @@ func (c *Couriers) CouriersMeta(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseInt(vars["courier_id"], 10, 64)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, c.logger, validation.Invalid("invalid courier_id %q", vars["courier_id"]))
+		return
 	}
 	start = r.URL.Query().Get("start_date")
 	end = r.URL.Query().Get("end_date")
 	ctx := r.Context()
-	err, result := c.service.CouriersMeta(ctx, start, end, id)
+	result, err := c.service.CouriersMeta(ctx, start, end, id)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+func (c *Couriers) GetAssignments(w http.ResponseWriter, r *http.Request) {
+	var courierID int64
+	date := time.Now().UTC()
+
+	if idStr := r.URL.Query().Get("courier_id"); idStr != "" {
+		var err error
+		courierID, err = strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			writeError(w, r, c.logger, validation.Invalid("invalid courier_id %q", idStr))
+			return
+		}
+	}
+
+	if dateStr := r.URL.Query().Get("date"); dateStr != "" {
+		var err error
+		date, err = time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			writeError(w, r, c.logger, validation.Invalid("invalid date %q, expected YYYY-MM-DD", dateStr))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	result, err := c.service.GetAssignments(ctx, date, courierID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, c.logger, err)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(result)
 }
+
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatch parses If-Match as RFC 9110 defines it: "*" accepts any current
+// version, otherwise a list of entity tags the courier's ETag must be one of.
+// The comparison is strong, so weak tags never match.
+func ifMatch(r *http.Request) (domain.VersionMatch, error) {
+	var m domain.VersionMatch
+	h := strings.TrimSpace(strings.Join(r.Header.Values("If-Match"), ","))
+	if h == "" {
+		return m, errPreconditionRequired
+	}
+	if h == "*" {
+		m.Any = true
+		return m, nil
+	}
+	for rest := h; ; {
+		rest = strings.TrimLeft(rest, " \t,")
+		if rest == "" {
+			return m, nil
+		}
+		weak := strings.HasPrefix(rest, "W/")
+		rest = strings.TrimPrefix(rest, "W/")
+		end := strings.IndexByte(strings.TrimPrefix(rest, `"`), '"')
+		if !strings.HasPrefix(rest, `"`) || end < 0 {
+			return m, validation.Invalid("invalid If-Match %q", h)
+		}
+		tag := rest[1 : end+1]
+		rest = rest[end+2:]
+		if rest != "" && !strings.ContainsAny(rest[:1], " \t,") {
+			return m, validation.Invalid("invalid If-Match %q", h)
+		}
+		if v, err := strconv.ParseInt(tag, 10, 64); err == nil && !weak {
+			m.Versions = append(m.Versions, v)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"yaa/internal/domain"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    domain.VersionMatch
+		wantErr error
+	}{
+		{header: "", wantErr: errPreconditionRequired},
+		{header: `"3"`, want: domain.VersionMatch{Versions: []int64{3}}},
+		{header: "*", want: domain.VersionMatch{Any: true}},
+		{header: `"3", "4",W/"5" ,"x"`, want: domain.VersionMatch{Versions: []int64{3, 4}}},
+		{header: `W/"3"`, want: domain.VersionMatch{}},
+		{header: `"a,b", "7"`, want: domain.VersionMatch{Versions: []int64{7}}},
+		{header: `3`, wantErr: domain.ErrValidation},
+		{header: `"3`, wantErr: domain.ErrValidation},
+		{header: `"3""4"`, wantErr: domain.ErrValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPatch, "/couriers/1", nil)
+			if tt.header != "" {
+				r.Header.Set("If-Match", tt.header)
+			}
+			got, err := ifMatch(r)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeCouriers keeps one courier and applies the version and deactivation
+// rules of the repository.
+type fakeCouriers struct {
+	CouriersService
+	courier    domain.Courier
+	lastChange time.Time
+}
+
+func (f *fakeCouriers) check(match domain.VersionMatch) error {
+	if !match.Matches(f.courier.Version) {
+		return fmt.Errorf("stale: %w", domain.ErrPreconditionFailed)
+	}
+	return nil
+}
+
+func (f *fakeCouriers) UpdateCourier(ctx context.Context, id int64, match domain.VersionMatch, patch domain.CourierPatch) (*domain.Courier, error) {
+	if err := f.check(match); err != nil {
+		return nil, err
+	}
+	if f.courier.DeactivatedAt != nil {
+		return nil, fmt.Errorf("deactivated: %w", domain.ErrConflict)
+	}
+	if patch.EffectiveFrom != nil && !patch.EffectiveFrom.After(f.lastChange) {
+		return nil, fmt.Errorf("effective_from must be after the last type change: %w", domain.ErrValidation)
+	}
+	if patch.Type != nil {
+		f.courier.Type = *patch.Type
+	}
+	f.courier.Version++
+	c := f.courier
+	return &c, nil
+}
+
+func (f *fakeCouriers) DeactivateCourier(ctx context.Context, id int64, match domain.VersionMatch) error {
+	if err := f.check(match); err != nil {
+		return err
+	}
+	if f.courier.DeactivatedAt == nil {
+		now := time.Now()
+		f.courier.DeactivatedAt = &now
+		f.courier.Version++
+	}
+	return nil
+}
+
+func TestUpdateAndDeactivateCourier(t *testing.T) {
+	svc := &fakeCouriers{
+		courier:    domain.Courier{Id: 1, Type: "FOOT", Version: 1},
+		lastChange: time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC),
+	}
+	r := mux.NewRouter()
+	NewCourier(logrus.New(), svc).RegisterCouriersRoutes(r)
+
+	steps := []struct {
+		name     string
+		method   string
+		ifMatch  string
+		body     string
+		status   int
+		wantETag string
+	}{
+		{"no If-Match", http.MethodPatch, "", `{"type":"BIKE"}`, http.StatusPreconditionRequired, ""},
+		{"stale version", http.MethodPatch, `"0"`, `{"type":"BIKE"}`, http.StatusPreconditionFailed, ""},
+		{"current version", http.MethodPatch, `"1"`, `{"type":"BIKE"}`, http.StatusOK, `"2"`},
+		{"old ETag after update", http.MethodPatch, `"1"`, `{"type":"AUTO"}`, http.StatusPreconditionFailed, ""},
+		{"effective_from before the last change", http.MethodPatch, `"2"`,
+			`{"type":"AUTO","effective_from":"2023-04-01T00:00:00Z"}`, http.StatusBadRequest, ""},
+		{"effective_from after the last change", http.MethodPatch, `"0", "2"`,
+			`{"type":"AUTO","effective_from":"2023-05-02T00:00:00Z"}`, http.StatusOK, `"3"`},
+		{"deactivate with a stale version", http.MethodDelete, `"2"`, "", http.StatusPreconditionFailed, ""},
+		{"deactivate", http.MethodDelete, "*", "", http.StatusNoContent, ""},
+		{"deactivate again", http.MethodDelete, "*", "", http.StatusNoContent, ""},
+		{"update a deactivated courier", http.MethodPatch, `"4"`, `{"type":"FOOT"}`, http.StatusConflict, ""},
+	}
+	for _, s := range steps {
+		req := httptest.NewRequest(s.method, "/couriers/1", strings.NewReader(s.body))
+		if s.ifMatch != "" {
+			req.Header.Set("If-Match", s.ifMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != s.status {
+			t.Errorf("%s: status %d, want %d: %s", s.name, w.Code, s.status, w.Body)
+		}
+		if got := w.Header().Get("ETag"); got != s.wantETag {
+			t.Errorf("%s: ETag %q, want %q", s.name, got, s.wantETag)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"yaa/internal/domain"
+	"yaa/internal/logging"
+	"yaa/internal/validation"
+	"yaa/pkg/tracing"
+
+	"github.com/sirupsen/logrus"
+)
+
+type errorResponse struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+	TraceID   string      `json:"trace_id,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, logger logrus.FieldLogger, err error) {
+	resp := errorResponse{
+		Message:   err.Error(),
+		RequestID: logging.RequestID(r.Context()),
+		TraceID:   tracing.TraceID(r.Context()),
+	}
+
+	var status int
+	var verrs validation.Errors
+	var serrs specErrors
+	var dup *domain.DuplicateError
+	switch {
+	case errors.As(err, &verrs):
+		status, resp.Code, resp.Message, resp.Details = http.StatusBadRequest, "validation_error", "validation failed", verrs
+	case errors.As(err, &serrs):
+		status, resp.Code, resp.Message, resp.Details = http.StatusBadRequest, "validation_error",
+			"request does not match the API specification", serrs
+	case errors.Is(err, domain.ErrValidation):
+		status, resp.Code = http.StatusBadRequest, "validation_error"
+	case errors.Is(err, domain.ErrNotFound):
+		status, resp.Code = http.StatusNotFound, "not_found"
+	case errors.As(err, &dup):
+		details := make(validation.Errors, 0, len(dup.IDs))
+		for i, id := range dup.IDs {
+			details = append(details, validation.FieldError{Index: dup.Index[i], Id: id, Field: "id", Message: "already exists"})
+		}
+		status, resp.Code, resp.Details = http.StatusConflict, "conflict", details
+	case errors.Is(err, domain.ErrConflict):
+		status, resp.Code = http.StatusConflict, "conflict"
+	case errors.Is(err, domain.ErrPreconditionFailed):
+		status, resp.Code = http.StatusPreconditionFailed, "precondition_failed"
+	case errors.Is(err, errPreconditionRequired):
+		status, resp.Code = http.StatusPreconditionRequired, "precondition_required"
+	case errors.Is(err, errBodyTooLarge):
+		status, resp.Code = http.StatusRequestEntityTooLarge, "payload_too_large"
+	default:
+		logging.FromContext(r.Context(), logger).WithError(err).Error("request failed")
+		status, resp.Code, resp.Message = http.StatusInternalServerError, "internal_error", "internal server error"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
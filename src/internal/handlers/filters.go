@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"yaa/internal/domain"
+	"yaa/internal/validation"
+)
+
+func parseCourierFilter(r *http.Request) (domain.CourierFilter, error) {
+	q := r.URL.Query()
+	var f domain.CourierFilter
+	var err error
+
+	switch t := q.Get("type"); t {
+	case "", "FOOT", "BIKE", "AUTO":
+		f.Type = t
+	default:
+		return f, validation.Invalid("invalid type %q, expected FOOT, BIKE or AUTO", t)
+	}
+	if f.Region, err = int32Param(q, "region"); err != nil {
+		return f, err
+	}
+	if f.WorkingHours, err = intervalParam(q, "working_hours"); err != nil {
+		return f, err
+	}
+	if s := q.Get("include_inactive"); s != "" {
+		if f.IncludeInactive, err = strconv.ParseBool(s); err != nil {
+			return f, validation.Invalid("invalid include_inactive %q", s)
+		}
+	}
+	return f, nil
+}
+
+func parseOrderFilter(r *http.Request) (domain.OrderFilter, error) {
+	q := r.URL.Query()
+	var f domain.OrderFilter
+	var err error
+
+	if f.Region, err = int32Param(q, "region"); err != nil {
+		return f, err
+	}
+	if s := q.Get("completed"); s != "" {
+		completed, err := strconv.ParseBool(s)
+		if err != nil {
+			return f, validation.Invalid("invalid completed %q", s)
+		}
+		f.Completed = &completed
+	}
+	if s := q.Get("status"); s != "" {
+		f.Status = domain.OrderStatus(s)
+		if !f.Status.Valid() {
+			return f, validation.Invalid("invalid status %q", s)
+		}
+	}
+	if f.MinWeight, err = float32Param(q, "min_weight"); err != nil {
+		return f, err
+	}
+	if f.MaxWeight, err = float32Param(q, "max_weight"); err != nil {
+		return f, err
+	}
+	if f.MinCost, err = int32Param(q, "min_cost"); err != nil {
+		return f, err
+	}
+	if f.MaxCost, err = int32Param(q, "max_cost"); err != nil {
+		return f, err
+	}
+	if f.DeliveryHours, err = intervalParam(q, "delivery_hours"); err != nil {
+		return f, err
+	}
+	if f.CompletedFrom, err = dateParam(q, "completed_from"); err != nil {
+		return f, err
+	}
+	if f.CompletedTo, err = dateParam(q, "completed_to"); err != nil {
+		return f, err
+	}
+
+	if f.MinWeight != nil && f.MaxWeight != nil && *f.MinWeight > *f.MaxWeight {
+		return f, validation.Invalid("min_weight must not exceed max_weight")
+	}
+	if f.MinCost != nil && f.MaxCost != nil && *f.MinCost > *f.MaxCost {
+		return f, validation.Invalid("min_cost must not exceed max_cost")
+	}
+	if f.CompletedFrom != nil && f.CompletedTo != nil && !f.CompletedFrom.Before(*f.CompletedTo) {
+		return f, validation.Invalid("completed_from must be before completed_to")
+	}
+	return f, nil
+}
+
+func parseImportMode(r *http.Request) (domain.ImportMode, error) {
+	s := r.URL.Query().Get("mode")
+	if s == "" {
+		return domain.ImportStrict, nil
+	}
+	mode := domain.ImportMode(s)
+	if !mode.Valid() {
+		return "", validation.Invalid("invalid mode %q", s)
+	}
+	return mode, nil
+}
+
+func int32Param(q url.Values, name string) (*int32, error) {
+	s := q.Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return nil, validation.Invalid("invalid %s %q", name, s)
+	}
+	res := int32(v)
+	return &res, nil
+}
+
+func float32Param(q url.Values, name string) (*float32, error) {
+	s := q.Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		return nil, validation.Invalid("invalid %s %q", name, s)
+	}
+	res := float32(v)
+	return &res, nil
+}
+
+func intervalParam(q url.Values, name string) (*domain.TimeInterval, error) {
+	s := q.Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	v, err := domain.ParseTimeInterval(s)
+	if err != nil {
+		return nil, validation.Invalid("invalid %s: %v", name, err)
+	}
+	return &v, nil
+}
+
+func dateParam(q url.Values, name string) (*time.Time, error) {
+	s := q.Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	v, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return nil, validation.Invalid("invalid %s %q, expected YYYY-MM-DD", name, s)
+	}
+	return &v, nil
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const readinessTimeout = 2 * time.Second
+
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type MigrationsChecker interface {
+	Pending(ctx context.Context) (int, error)
+}
+
+type Health struct {
+	db           Pinger
+	migrations   MigrationsChecker
+	shuttingDown int32
+	logger       logrus.FieldLogger
+}
+
+type checkResult struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+func NewHealth(logger logrus.FieldLogger, db Pinger, migrations MigrationsChecker) *Health {
+	return &Health{
+		db:         db,
+		migrations: migrations,
+		logger:     logger,
+	}
+}
+
+func (c *Health) RegisterHealthRoutes(r *mux.Router) {
+	r.HandleFunc("/healthz", c.Healthz).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", c.Readyz).Methods(http.MethodGet)
+}
+
+// SetShuttingDown makes readiness fail so traffic drains before the server stops.
+func (c *Health) SetShuttingDown() {
+	atomic.StoreInt32(&c.shuttingDown, 1)
+}
+
+func (c *Health) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+func (c *Health) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	resp := healthResponse{Status: "ok", Checks: map[string]checkResult{}}
+
+	resp.Checks["postgres"] = check(func() error {
+		return c.db.Ping(ctx)
+	})
+	resp.Checks["migrations"] = check(func() error {
+		pending, err := c.migrations.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return fmt.Errorf("%d pending migrations", pending)
+		}
+		return nil
+	})
+	resp.Checks["shutdown"] = check(func() error {
+		if atomic.LoadInt32(&c.shuttingDown) == 1 {
+			return fmt.Errorf("server is shutting down")
+		}
+		return nil
+	})
+
+	status := http.StatusOK
+	for name, res := range resp.Checks {
+		if res.Status != "ok" {
+			c.logger.Warnf("readiness check %s failed: %s", name, res.Error)
+			resp.Status, status = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+	writeHealth(w, status, resp)
+}
+
+func check(fn func() error) checkResult {
+	start := time.Now()
+	err := fn()
+	res := checkResult{Status: "ok", LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		res.Status, res.Error = "fail", err.Error()
+	}
+	return res
+}
+
+func writeHealth(w http.ResponseWriter, status int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
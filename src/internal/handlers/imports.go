@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"yaa/internal/domain"
+	"yaa/internal/validation"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+type ImportsService interface {
+	SubmitOrders(ctx context.Context, format string, mode domain.ImportMode, payload []byte) (domain.ImportJob, error)
+	GetImport(ctx context.Context, id int64) (domain.ImportJob, error)
+}
+
+type Imports struct {
+	service ImportsService
+	logger  logrus.FieldLogger
+}
+
+func NewImport(logger logrus.FieldLogger, service ImportsService) *Imports {
+	return &Imports{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (c *Imports) RegisterImportsRoutes(r *mux.Router) {
+	r.HandleFunc("/imports/orders", c.ImportOrders).Methods(http.MethodPost)
+	r.HandleFunc("/imports/{import_id:[0-9]+}", c.GetImport).Methods(http.MethodGet)
+}
+
+// ImportOrders stores the uploaded file as an import job and returns at once;
+// the file is parsed and imported in the background.
+func (c *Imports) ImportOrders(w http.ResponseWriter, r *http.Request) {
+	mode, err := parseImportMode(r)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+	format, err := importFormat(r)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		if !errors.Is(err, errBodyTooLarge) {
+			err = validation.Invalid("invalid request body: %v", err)
+		}
+		writeError(w, r, c.logger, err)
+		return
+	}
+	if len(bytes.TrimSpace(payload)) == 0 {
+		writeError(w, r, c.logger, validation.Invalid("import file is empty"))
+		return
+	}
+
+	ctx := r.Context()
+	job, err := c.service.SubmitOrders(ctx, format, mode, payload)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/imports/%d", job.Id))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (c *Imports) GetImport(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["import_id"], 10, 64)
+	if err != nil {
+		writeError(w, r, c.logger, validation.Invalid("invalid import_id %q", vars["import_id"]))
+		return
+	}
+
+	ctx := r.Context()
+	job, err := c.service.GetImport(ctx, id)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
+
+// importFormat takes the file format from the format parameter, falling back
+// to the Content-Type of the upload.
+func importFormat(r *http.Request) (string, error) {
+	if s := r.URL.Query().Get("format"); s != "" {
+		switch s {
+		case domain.ImportJSON, domain.ImportNDJSON, domain.ImportCSV:
+			return s, nil
+		}
+		return "", validation.Invalid("invalid format %q", s)
+	}
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mt {
+	case "application/json":
+		return domain.ImportJSON, nil
+	case "application/x-ndjson", "application/ndjson":
+		return domain.ImportNDJSON, nil
+	case "text/csv":
+		return domain.ImportCSV, nil
+	}
+	return "", validation.Invalid("unsupported Content-Type %q, set format to json, ndjson or csv", r.Header.Get("Content-Type"))
+}
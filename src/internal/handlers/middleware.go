@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+	"yaa/internal/logging"
+	"yaa/internal/validation"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+var errBodyTooLarge = errors.New("request body too large")
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Probe for one more byte so a body of exactly the limit is accepted.
+		var one [1]byte
+		n, err := b.ReadCloser.Read(one[:])
+		if n > 0 {
+			return 0, errBodyTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// LimitBody rejects POST, PUT and PATCH bodies larger than max bytes.
+func LimitBody(logger logrus.FieldLogger, max int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.ContentLength > max {
+				writeError(w, r, logger, errBodyTooLarge)
+				return
+			}
+			r.Body = &limitedBody{ReadCloser: r.Body, remaining: max}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Deadline gives the requests it wraps d to be read, handled and answered,
+// in place of the read and write timeouts of the server, and cancels their
+// context when d is up.
+func Deadline(logger logrus.FieldLogger, d time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			deadline := time.Now().Add(d)
+			rc := http.NewResponseController(w)
+			err := rc.SetReadDeadline(deadline)
+			if err == nil {
+				err = rc.SetWriteDeadline(deadline)
+			}
+			if err != nil {
+				logging.FromContext(r.Context(), logger).WithError(err).Warn("cannot extend connection deadlines")
+			}
+			ctx, cancel := context.WithDeadline(r.Context(), deadline)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func decodeBody(r *http.Request, v interface{}) error {
+	err := validation.Decode(r.Body, v)
+	if err == nil || errors.Is(err, errBodyTooLarge) {
+		return err
+	}
+	return validation.Invalid("invalid request body: %v", err)
+}
+
+// batchChunkSize is the number of items of a bulk import that are validated
+// and stored together.
+const batchChunkSize = 1000
+
+// passErr carries an error of a decodeItems callback that is not about the
+// body, such as a failed insert, past the wrapping of malformed bodies.
+type passErr struct {
+	err error
+}
+
+func (e passErr) Error() string {
+	return e.err.Error()
+}
+
+// decodeItems streams the elements of the array field of the body to next.
+func decodeItems(r *http.Request, field string, next func(dec *json.Decoder) error) error {
+	err := validation.DecodeItems(r.Body, field, next)
+	var pass passErr
+	if errors.As(err, &pass) {
+		return pass.err
+	}
+	if err == nil || errors.Is(err, errBodyTooLarge) {
+		return err
+	}
+	return validation.Invalid("invalid request body: %v", err)
+}
+
+// batchFeed reads the array field of the body as a feed of chunks of
+// batchChunkSize items, checking each chunk with check. Chunks go to flush
+// while the batch is valid; once one is not, the rest of the body is only
+// checked, to report all errors.
+func batchFeed[T any](r *http.Request, field string,
+	check func(b *validation.Batch, chunk []T) bool) func(flush func(chunk []T) error) error {
+	return func(flush func(chunk []T) error) error {
+		batch := validation.NewBatch(field)
+		chunk := make([]T, 0, batchChunkSize)
+		store := func() error {
+			if check(batch, chunk) {
+				if err := flush(chunk); err != nil {
+					return err
+				}
+			}
+			chunk = chunk[:0]
+			return nil
+		}
+		err := decodeItems(r, field, func(dec *json.Decoder) error {
+			var v T
+			if err := dec.Decode(&v); err != nil {
+				return err
+			}
+			chunk = append(chunk, v)
+			if len(chunk) < batchChunkSize {
+				return nil
+			}
+			if err := store(); err != nil {
+				return passErr{err}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(chunk) > 0 {
+			if err = store(); err != nil {
+				return err
+			}
+		}
+		return batch.Err()
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"yaa/pkg/respwriter"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+func TestDeadlineOutlastsServerTimeouts(t *testing.T) {
+	r := mux.NewRouter()
+	read := func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+	r.HandleFunc("/short", read)
+	long := r.NewRoute().Subrouter()
+	long.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(respwriter.Wrap(w), r)
+		})
+	})
+	long.Use(Deadline(logrus.New(), 5*time.Second))
+	long.HandleFunc("/long", read)
+
+	srv := httptest.NewUnstartedServer(r)
+	srv.Config.ReadTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		path string
+		ok   bool
+	}{{"/short", false}, {"/long", true}} {
+		body, pw := io.Pipe()
+		go func() {
+			for i := 0; i < 3; i++ {
+				time.Sleep(60 * time.Millisecond)
+				if _, err := pw.Write([]byte("x")); err != nil {
+					return
+				}
+			}
+			pw.Close()
+		}()
+		res, err := http.Post(srv.URL+tt.path, "text/plain", body)
+		if err == nil {
+			res.Body.Close()
+		}
+		if ok := err == nil && res.StatusCode == http.StatusNoContent; ok != tt.ok {
+			t.Errorf("%s: slow body read %v, want %v (err %v)", tt.path, ok, tt.ok, err)
+		}
+	}
+}
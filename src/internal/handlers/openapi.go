@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"yaa/internal/domain"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>API documentation</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+
+// specViolation describes one part of a request that does not match the spec.
+type specViolation struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type specErrors []specViolation
+
+func (e specErrors) Is(target error) bool {
+	return target == domain.ErrValidation
+}
+
+func (e specErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, v := range e {
+		msgs = append(msgs, v.Field+": "+v.Message)
+	}
+	return "request does not match the API specification: " + strings.Join(msgs, "; ")
+}
+
+type OpenAPI struct {
+	doc               []byte
+	router            routers.Router
+	validateRequests  bool
+	validateResponses bool
+	logger            logrus.FieldLogger
+}
+
+// NewOpenAPI serves the spec and validates traffic against it. Response
+// validation buffers every response and is meant for tests and staging.
+func NewOpenAPI(logger logrus.FieldLogger, spec *openapi3.T, validateRequests, validateResponses bool) (*OpenAPI, error) {
+	doc, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	router, err := gorillamux.NewRouter(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &OpenAPI{
+		doc:               doc,
+		router:            router,
+		validateRequests:  validateRequests,
+		validateResponses: validateResponses,
+		logger:            logger,
+	}, nil
+}
+
+func (c *OpenAPI) RegisterOpenAPIRoutes(r *mux.Router) {
+	r.HandleFunc("/openapi.json", c.Spec).Methods(http.MethodGet)
+	r.HandleFunc("/docs", c.Docs).Methods(http.MethodGet)
+}
+
+func (c *OpenAPI) Spec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(c.doc)
+}
+
+func (c *OpenAPI) Docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(swaggerUI))
+}
+
+// Middleware rejects requests that do not match the spec and, when response
+// validation is on, replaces responses that drift from it with a 500.
+// Routes missing from the spec, such as /metrics, pass through unchecked.
+func (c *OpenAPI) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.validateRequests && !c.validateResponses {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route, params, err := c.router.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		in := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: params,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError:         true,
+				ExcludeRequestBody: streamsBody(route.Operation),
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+		if c.validateRequests {
+			err = openapi3filter.ValidateRequest(r.Context(), in)
+			if errors.Is(err, errBodyTooLarge) {
+				writeError(w, r, c.logger, errBodyTooLarge)
+				return
+			}
+			if err != nil {
+				writeError(w, r, c.logger, requestViolations(err))
+				return
+			}
+		}
+		if !c.validateResponses {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &responseRecorder{header: make(http.Header), status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		out := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: in,
+			Status:                 rec.status,
+			Header:                 rec.header,
+			Options:                &openapi3filter.Options{MultiError: true, IncludeResponseStatus: true},
+		}
+		out.SetBodyBytes(rec.body.Bytes())
+		if err = openapi3filter.ValidateResponse(r.Context(), out); err != nil {
+			writeError(w, r, c.logger, fmt.Errorf("%s %s: response does not match the API specification: %w",
+				r.Method, route.Path, err))
+			return
+		}
+
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+	})
+}
+
+// streamsBody reports whether the operation is marked x-stream-body: its
+// handler decodes and validates the body as a stream, which buffering the body
+// for the spec check would defeat.
+func streamsBody(op *openapi3.Operation) bool {
+	stream, _ := op.Extensions["x-stream-body"].(bool)
+	return stream
+}
+
+func requestViolations(err error) specErrors {
+	var res specErrors
+	collectViolations(&res, "", err)
+	return res
+}
+
+// collectViolations flattens the nested errors returned by kin-openapi into
+// one violation per offending parameter or body field.
+func collectViolations(dst *specErrors, field string, err error) {
+	var multi openapi3.MultiError
+	if errors.As(err, &multi) && !isRequestError(err) {
+		for _, e := range multi {
+			collectViolations(dst, field, e)
+		}
+		return
+	}
+
+	var reqErr *openapi3filter.RequestError
+	if errors.As(err, &reqErr) {
+		switch {
+		case reqErr.Parameter != nil:
+			field = reqErr.Parameter.Name
+		case reqErr.RequestBody != nil:
+			field = "body"
+		}
+		if reqErr.Err != nil {
+			collectViolations(dst, field, reqErr.Err)
+			return
+		}
+		*dst = append(*dst, specViolation{Field: field, Message: reqErr.Reason})
+		return
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		if ptr := schemaErr.JSONPointer(); len(ptr) > 0 && field == "body" {
+			field = strings.Join(ptr, ".")
+		}
+		*dst = append(*dst, specViolation{Field: field, Message: schemaErr.Reason})
+		return
+	}
+	*dst = append(*dst, specViolation{Field: field, Message: err.Error()})
+}
+
+func isRequestError(err error) bool {
+	_, ok := err.(*openapi3filter.RequestError)
+	return ok
+}
+
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	return w.body.Write(p)
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strconv"
 	"yaa/internal/domain"
+	"yaa/internal/validation"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
@@ -13,9 +14,14 @@ import (
 
 type OrdersService interface {
 	GetOrder(ctx context.Context, id int64) (*domain.Order, error)
-	GetOrders(ctx context.Context, o, l int) (domain.OrderSl, error)
-	AddOrders(ctx context.Context, orders domain.OrderSl) error
-	CompleteOrders(ctx context.Context, compOrd domain.ComplOrderSl) error
+	GetOrders(ctx context.Context, f domain.OrderFilter, p domain.PageRequest) (domain.OrderPage, error)
+	AddOrders(ctx context.Context, feed domain.OrderFeed, mode domain.ImportMode) (domain.ImportResult, error)
+	CompleteOrders(ctx context.Context, compOrd domain.ComplOrderSl) (domain.OrderSl, error)
+	CancelOrder(ctx context.Context, id int64, req domain.OrderCancel) (*domain.Order, error)
+	ReassignOrder(ctx context.Context, id int64, req domain.OrderReassign) (*domain.Order, error)
+	PickUpOrder(ctx context.Context, id, courID int64) (*domain.Order, error)
+	FailOrder(ctx context.Context, id, courID int64) (*domain.Order, error)
+	GetOrderHistory(ctx context.Context, id int64) (domain.OrderHistory, error)
 }
 
 type Orders struct {
@@ -33,24 +39,33 @@ func NewOrder(logger logrus.FieldLogger, service OrdersService) *Orders {
 func (c *Orders) RegisterOrdersRoutes(r *mux.Router) {
 	r.HandleFunc("/orders/{order_id}", c.GetOrder).Methods(http.MethodGet)
 	r.HandleFunc("/orders", c.GetOrders).Methods(http.MethodGet)
-	r.HandleFunc("/orders", c.AddOrders).Methods(http.MethodPost)
+	r.HandleFunc("/orders/complete", c.CompleteOrders).Methods(http.MethodPost)
 	r.HandleFunc("/ordcompl", c.CompleteOrders).Methods(http.MethodPost)
+	r.HandleFunc("/orders/{order_id:[0-9]+}/history", c.GetOrderHistory).Methods(http.MethodGet)
+	r.HandleFunc("/orders/{order_id:[0-9]+}/cancel", c.CancelOrder).Methods(http.MethodPost)
+	r.HandleFunc("/orders/{order_id:[0-9]+}/reassign", c.ReassignOrder).Methods(http.MethodPost)
+	r.HandleFunc("/orders/{order_id:[0-9]+}/pickup", c.PickUpOrder).Methods(http.MethodPost)
+	r.HandleFunc("/orders/{order_id:[0-9]+}/fail", c.FailOrder).Methods(http.MethodPost)
+}
+
+// RegisterOrdersBatchRoutes registers the bulk import, which gets a larger
+// body limit than the other routes.
+func (c *Orders) RegisterOrdersBatchRoutes(r *mux.Router) {
+	r.HandleFunc("/orders", c.AddOrders).Methods(http.MethodPost)
 }
 
 func (c *Orders) GetOrder(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseInt(vars["order_id"], 10, 64)
 	if err != nil {
-		c.logger.Errorf("Error converting id to int: %v\n", err)
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, r, c.logger, validation.Invalid("invalid order_id %q", vars["order_id"]))
 		return
 	}
 
 	ctx := r.Context()
 	order, err := c.service.GetOrder(ctx, id)
 	if err != nil {
-		c.logger.Errorf("Error getting order: %v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, c.logger, err)
 		return
 	}
 
@@ -60,33 +75,21 @@ func (c *Orders) GetOrder(w http.ResponseWriter, r *http.Request) {
 }
 
 func (c *Orders) GetOrders(w http.ResponseWriter, r *http.Request) {
-	offset, limit := 0, 1
-	offsetStr := r.URL.Query().Get("offset")
-	limitStr := r.URL.Query().Get("limit")
-
-	if offsetStr != "" {
-		var err error
-		offset, err = strconv.Atoi(offsetStr)
-		if err != nil {
-			c.logger.Errorf("Error convert offset: %v\n", err)
-			return
-		}
+	page, err := parsePage(r)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
 	}
-
-	if limitStr != "" {
-		var err error
-		limit, err = strconv.Atoi(limitStr)
-		if err != nil {
-			c.logger.Errorf("Error convert limit: %v\n", err)
-			return
-		}
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
 	}
 
 	ctx := r.Context()
-	orders, err := c.service.GetOrders(ctx, offset, limit)
+	orders, err := c.service.GetOrders(ctx, filter, page)
 	if err != nil {
-		c.logger.Error(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, c.logger, err)
 		return
 	}
 
@@ -95,32 +98,151 @@ func (c *Orders) GetOrders(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(orders)
 }
 
+// AddOrders stores the orders of the body in one transaction, a chunk at a time
+// as they are read.
 func (c *Orders) AddOrders(w http.ResponseWriter, r *http.Request) {
-	var OrdersSl domain.OrderSl
-	err := json.NewDecoder(r.Body).Decode(&OrdersSl)
+	mode, err := parseImportMode(r)
 	if err != nil {
-		c.logger.Error(http.StatusBadRequest)
+		writeError(w, r, c.logger, err)
 		return
 	}
 
 	ctx := r.Context()
-	err = c.service.AddOrders(ctx, OrdersSl)
+	res, err := c.service.AddOrders(ctx, batchFeed(r, "orders", (*validation.Batch).Orders), mode)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, c.logger, err)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
 }
 
 func (c *Orders) CompleteOrders(w http.ResponseWriter, r *http.Request) {
 	var compOrdersSl domain.ComplOrderSl
-	err := json.NewDecoder(r.Body).Decode(&compOrdersSl)
+	err := decodeBody(r, &compOrdersSl)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+
+	err = validation.CompleteOrders(compOrdersSl)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+
+	ctx := r.Context()
+	orders, err := c.service.CompleteOrders(ctx, compOrdersSl)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(orders)
+}
+
+func (c *Orders) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["order_id"], 10, 64)
+	if err != nil {
+		writeError(w, r, c.logger, validation.Invalid("invalid order_id %q", vars["order_id"]))
+		return
+	}
+
+	ctx := r.Context()
+	history, err := c.service.GetOrderHistory(ctx, id)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(history)
+}
+
+func (c *Orders) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	var req domain.OrderCancel
+	err := decodeBody(r, &req)
 	if err != nil {
-		c.logger.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, r, c.logger, err)
+		return
+	}
+	err = validation.OrderCancel(req)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+	c.changeStatus(w, r, func(ctx context.Context, id int64) (*domain.Order, error) {
+		return c.service.CancelOrder(ctx, id, req)
+	})
+}
+
+func (c *Orders) ReassignOrder(w http.ResponseWriter, r *http.Request) {
+	var req domain.OrderReassign
+	err := decodeBody(r, &req)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+	err = validation.OrderReassign(req)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+	c.changeStatus(w, r, func(ctx context.Context, id int64) (*domain.Order, error) {
+		return c.service.ReassignOrder(ctx, id, req)
+	})
+}
+
+func (c *Orders) PickUpOrder(w http.ResponseWriter, r *http.Request) {
+	c.courierAction(w, r, c.service.PickUpOrder)
+}
+
+func (c *Orders) FailOrder(w http.ResponseWriter, r *http.Request) {
+	c.courierAction(w, r, c.service.FailOrder)
+}
+
+// courierAction decodes the acting courier from the body and applies op.
+func (c *Orders) courierAction(w http.ResponseWriter, r *http.Request,
+	op func(ctx context.Context, id, courID int64) (*domain.Order, error)) {
+	var action domain.OrderAction
+	err := decodeBody(r, &action)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+	err = validation.OrderAction(action)
+	if err != nil {
+		writeError(w, r, c.logger, err)
+		return
+	}
+	c.changeStatus(w, r, func(ctx context.Context, id int64) (*domain.Order, error) {
+		return op(ctx, id, action.IdCourier)
+	})
+}
+
+func (c *Orders) changeStatus(w http.ResponseWriter, r *http.Request,
+	op func(ctx context.Context, id int64) (*domain.Order, error)) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["order_id"], 10, 64)
+	if err != nil {
+		writeError(w, r, c.logger, validation.Invalid("invalid order_id %q", vars["order_id"]))
 		return
 	}
 
 	ctx := r.Context()
-	err = c.service.CompleteOrders(ctx, compOrdersSl)
+	order, err := op(ctx, id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, c.logger, err)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(order)
 }
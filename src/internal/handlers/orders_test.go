@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"yaa/internal/domain"
+	"yaa/internal/validation"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeOrders records the chunks a bulk import is flushed in. flushErr fails
+// the flush of the chunk with that index.
+type fakeOrders struct {
+	OrdersService
+	chunks   []int
+	flushErr map[int]error
+}
+
+func (f *fakeOrders) AddOrders(ctx context.Context, feed domain.OrderFeed, mode domain.ImportMode) (domain.ImportResult, error) {
+	res := domain.NewImportResult()
+	err := feed(func(chunk []domain.Order) error {
+		if err := f.flushErr[len(f.chunks)]; err != nil {
+			return err
+		}
+		f.chunks = append(f.chunks, len(chunk))
+		for _, o := range chunk {
+			res.Created = append(res.Created, o.Id)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func ordersBody(n int, bad map[int]bool) string {
+	var b strings.Builder
+	b.WriteString(`{"orders":[`)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		weight := 1
+		if bad[i] {
+			weight = 0
+		}
+		fmt.Fprintf(&b, `{"id":%d,"weight":%d,"regions":1,"cost":10,"delivery_hours":["10:00-12:00"]}`, i+1, weight)
+	}
+	b.WriteString(`]}`)
+	return b.String()
+}
+
+func TestAddOrdersFlushesChunks(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		flushErr   map[int]error
+		status     int
+		wantChunks []int
+		wantIndex  []int
+	}{
+		{name: "chunks", body: ordersBody(2500, nil), status: http.StatusOK,
+			wantChunks: []int{1000, 1000, 500}},
+		{name: "exactly one chunk", body: ordersBody(1000, nil), status: http.StatusOK, wantChunks: []int{1000}},
+		{name: "empty", body: `{"orders":[]}`, status: http.StatusBadRequest, wantIndex: []int{0}},
+		{name: "invalid items stop the flushes but not validation", body: ordersBody(2500, map[int]bool{1500: true, 2400: true}),
+			status: http.StatusBadRequest, wantChunks: []int{1000}, wantIndex: []int{1500, 2400}},
+		{name: "duplicate ids across chunks", body: strings.Replace(ordersBody(1200, nil), `"id":1100,`, `"id":5,`, 1),
+			status: http.StatusBadRequest, wantChunks: []int{1000}, wantIndex: []int{1099}},
+		{name: "failed flush is not a bad body", body: ordersBody(2500, nil),
+			flushErr: map[int]error{1: &domain.DuplicateError{Index: []int{1000}, IDs: []int64{1001}}},
+			status:   http.StatusConflict, wantChunks: []int{1000}},
+		{name: "malformed item", body: `{"orders":[{"id":1,"weight":1,"regions":1,"cost":10,"delivery_hours":["10:00-12:00"]},{"id":`,
+			status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &fakeOrders{flushErr: tt.flushErr}
+			r := mux.NewRouter()
+			NewOrder(logrus.New(), svc).RegisterOrdersBatchRoutes(r)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(tt.body)))
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if !reflect.DeepEqual(svc.chunks, tt.wantChunks) {
+				t.Errorf("flushed chunks %v, want %v", svc.chunks, tt.wantChunks)
+			}
+			if tt.wantIndex == nil {
+				return
+			}
+			var body struct {
+				Details validation.Errors `json:"details"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, e := range body.Details {
+				got = append(got, e.Index)
+			}
+			if !reflect.DeepEqual(got, tt.wantIndex) {
+				t.Errorf("error indexes %v, want %v", got, tt.wantIndex)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"yaa/internal/domain"
+	"yaa/internal/validation"
+)
+
+// parsePage reads limit, offset, cursor, sort and total from the query
+// string. offset and cursor are mutually exclusive; without either the first
+// page is returned in offset mode. sort names one field, prefixed with "-"
+// for descending order; the repository rejects fields it cannot sort by.
+func parsePage(r *http.Request) (domain.PageRequest, error) {
+	q := r.URL.Query()
+	p := domain.PageRequest{Limit: domain.DefaultPageLimit}
+
+	if limitStr := q.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > domain.MaxPageLimit {
+			return p, validation.Invalid("invalid limit %q, expected 1..%d", limitStr, domain.MaxPageLimit)
+		}
+		p.Limit = limit
+	}
+
+	offsetStr, cursor := q.Get("offset"), q.Get("cursor")
+	if offsetStr != "" && cursor != "" {
+		return p, validation.Invalid("offset and cursor are mutually exclusive")
+	}
+	if offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return p, validation.Invalid("invalid offset %q", offsetStr)
+		}
+		p.Offset = offset
+	}
+	if cursor != "" {
+		after, err := domain.DecodeCursor(cursor)
+		if err != nil {
+			return p, err
+		}
+		p.After, p.ByCursor = after, true
+	}
+
+	if sort := q.Get("sort"); sort != "" {
+		p.Sort, p.Desc = strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+		if p.ByCursor && p.Sort != domain.SortByID {
+			return p, validation.Invalid("cursor pagination requires sort by id")
+		}
+	}
+
+	if totalStr := q.Get("total"); totalStr != "" {
+		total, err := strconv.ParseBool(totalStr)
+		if err != nil {
+			return p, validation.Invalid("invalid total %q", totalStr)
+		}
+		p.WithTotal = total
+	}
+	return p, nil
+}
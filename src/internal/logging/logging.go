@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"time"
+	"yaa/pkg/respwriter"
+	"yaa/pkg/tracing"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+type loggerKey struct{}
+
+type requestIDKey struct{}
+
+func WithLogger(ctx context.Context, logger logrus.FieldLogger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the request-scoped logger, or fallback outside a request.
+func FromContext(ctx context.Context, fallback logrus.FieldLogger) logrus.FieldLogger {
+	if logger, ok := ctx.Value(loggerKey{}).(logrus.FieldLogger); ok {
+		return logger
+	}
+	return fallback
+}
+
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Middleware assigns or propagates X-Request-ID and stores a logger carrying
+// the request fields in the request context.
+func Middleware(base logrus.FieldLogger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID.MatchString(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			fields := logrus.Fields{
+				"request_id": id,
+				"method":     r.Method,
+				"route":      r.URL.Path,
+			}
+			if cur := mux.CurrentRoute(r); cur != nil {
+				if tpl, err := cur.GetPathTemplate(); err == nil {
+					fields["route"] = tpl
+				}
+			}
+			if traceID := tracing.TraceID(r.Context()); traceID != "" {
+				fields["trace_id"] = traceID
+			}
+			for _, name := range []string{"courier_id", "order_id"} {
+				if v, ok := mux.Vars(r)[name]; ok {
+					fields[name] = v
+				} else if v := r.URL.Query().Get(name); v != "" {
+					fields[name] = v
+				}
+			}
+			logger := base.WithFields(fields)
+
+			ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+			ctx = WithLogger(ctx, logger)
+
+			sw := respwriter.Wrap(w)
+			next.ServeHTTP(sw, r.WithContext(ctx))
+
+			logger.WithFields(logrus.Fields{
+				"status":     sw.Status(),
+				"latency_ms": time.Since(start).Milliseconds(),
+			}).Info("request completed")
+		})
+	}
+}
+
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b[:])
+}
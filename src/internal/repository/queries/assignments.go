@@ -0,0 +1,169 @@
+package queries
+
+import (
+	"context"
+	"time"
+	"yaa/internal/domain"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// assignmentLockKey names the advisory lock held by assignment runs and by
+// everything that changes what they plan around.
+const assignmentLockKey int64 = 0x79616173
+
+// WithAssignmentLock runs fn in a transaction that holds the assignment lock,
+// like InTx, so a run reads the couriers, orders and trips and writes its
+// groups on the one connection it waited on. Runs read the pool of
+// unassigned orders before writing their groups; two overlapping runs would
+// otherwise pick the same orders.
+func (r *Queries) WithAssignmentLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.InTx(ctx, func(ctx context.Context) error {
+		if err := lockAssignments(ctx, txFrom(ctx)); err != nil {
+			return err
+		}
+		return fn(ctx)
+	})
+}
+
+// lockAssignments waits until no other assignment run is in progress. The
+// lock is released when tx ends.
+func lockAssignments(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", assignmentLockKey)
+	return err
+}
+
+func (r *Queries) GetCouriersBusyUntil(ctx context.Context, date time.Time) (map[int64]time.Time, error) {
+	query := "SELECT courier_id, MAX(finish_time) FROM delivery_groups WHERE assign_date = $1 GROUP BY courier_id"
+	rows, err := r.pool.Query(ctx, query, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	busy := make(map[int64]time.Time)
+
+	for rows.Next() {
+		var (
+			id     int64
+			finish time.Time
+		)
+		err = rows.Scan(&id, &finish)
+		if err != nil {
+			return nil, err
+		}
+		busy[id] = finish
+	}
+	return busy, rows.Err()
+}
+
+func (r *Queries) AddAssignments(ctx context.Context, date time.Time, assignments []domain.CourierAssignment) (err error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+
+	return insertGroups(ctx, tx, date, assignments, domain.ActorDispatcher)
+}
+
+// ReassignOrder moves an order held by one courier, or failed by it, to a new
+// delivery group of another in one transaction: release, the new group, then
+// the assignment. t moves the order back to created; a holds the group.
+func (r *Queries) ReassignOrder(ctx context.Context, t domain.OrderTransition, date time.Time,
+	a domain.CourierAssignment) (_ domain.Order, err error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return domain.Order{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+
+	_, err = applyTransition(ctx, tx, t)
+	if err != nil {
+		return domain.Order{}, err
+	}
+	err = insertGroups(ctx, tx, date, []domain.CourierAssignment{a}, t.Actor)
+	if err != nil {
+		return domain.Order{}, err
+	}
+	var o domain.Order
+	err = scanOrder(tx.QueryRow(ctx, "SELECT "+orderColumns+" FROM orders WHERE id = $1", t.OrderID), &o)
+	return o, err
+}
+
+// insertGroups stores the delivery groups and moves their orders from created
+// to assigned on behalf of actor.
+func insertGroups(ctx context.Context, tx pgx.Tx, date time.Time, assignments []domain.CourierAssignment,
+	actor string) error {
+	for i := range assignments {
+		for j := range assignments[i].Groups {
+			g := &assignments[i].Groups[j]
+			err := tx.QueryRow(ctx, `INSERT INTO delivery_groups (courier_id, assign_date, start_time, finish_time, cost)
+			VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+				assignments[i].IdCourier, date, g.StartTime, g.FinishTime, g.Cost).Scan(&g.Id)
+			if err != nil {
+				return err
+			}
+			for pos, orderID := range g.Orders {
+				_, err = tx.Exec(ctx, "INSERT INTO group_orders (group_id, order_id, position) VALUES ($1, $2, $3)",
+					g.Id, orderID, pos)
+				if err != nil {
+					return wrapErr(err)
+				}
+				_, err = applyTransition(ctx, tx, domain.OrderTransition{OrderID: orderID, From: domain.OrderCreated,
+					To: domain.OrderAssigned, Actor: actor, CourierID: &assignments[i].IdCourier})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Queries) GetAssignments(ctx context.Context, date time.Time, courID int64) ([]domain.CourierAssignment, error) {
+	query := `SELECT g.id, g.courier_id, g.start_time, g.finish_time, g.cost, array_agg(o.order_id ORDER BY o.position)
+	FROM delivery_groups g
+	JOIN group_orders o ON o.group_id = g.id
+	WHERE g.assign_date = $1 AND ($2::bigint = 0 OR g.courier_id = $2)
+	GROUP BY g.id
+	ORDER BY g.courier_id, g.start_time`
+	rows, err := r.pool.Query(ctx, query, date, courID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assignments []domain.CourierAssignment
+
+	for rows.Next() {
+		var (
+			g  domain.DeliveryGroup
+			id int64
+		)
+		err = rows.Scan(&g.Id, &id, &g.StartTime, &g.FinishTime, &g.Cost, &g.Orders)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(assignments); n == 0 || assignments[n-1].IdCourier != id {
+			assignments = append(assignments, domain.CourierAssignment{IdCourier: id})
+		}
+		last := &assignments[len(assignments)-1]
+		last.Groups = append(last.Groups, g)
+	}
+	return assignments, rows.Err()
+}
@@ -0,0 +1,83 @@
+package queries
+
+import (
+	"context"
+	"testing"
+	"time"
+	"yaa/internal/domain"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestAssignmentLockOutnumbersPool(t *testing.T) {
+	_, pool := testDB(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cfg := pool.Config()
+	cfg.MaxConns = 2
+	small, err := pgxpool.ConnectConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer small.Close()
+	q := New(small)
+
+	// Every run reads while holding the lock, as assignment runs do; with
+	// more runs than connections none may wait for a second connection.
+	const runs = 8
+	errs := make(chan error, runs)
+	for i := 0; i < runs; i++ {
+		go func() {
+			errs <- q.WithAssignmentLock(ctx, func(ctx context.Context) error {
+				if _, err := q.GetAllCouriers(ctx); err != nil {
+					return err
+				}
+				_, err := q.GetCouriersBusyUntil(ctx, time.Now())
+				return err
+			})
+		}()
+	}
+	for i := 0; i < runs; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDeactivateWaitsForAssignmentRun(t *testing.T) {
+	q, _ := testDB(t)
+	ctx := context.Background()
+
+	iv, err := domain.ParseTimeInterval("09:00-18:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = q.AddCouriers(ctx, domain.CourierSl{Couriers: []domain.Courier{
+		{Id: 1, Type: "FOOT", Regions: []int32{1}, WorkHours: []domain.TimeInterval{iv}},
+	}}, domain.ImportStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	err = q.WithAssignmentLock(ctx, func(ctx context.Context) error {
+		go func() { done <- q.DeactivateCourier(context.Background(), 1, domain.VersionMatch{Any: true}) }()
+		select {
+		case err := <-done:
+			t.Fatalf("deactivated during an assignment run: %v", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+		couriers, err := q.GetAllCouriers(ctx)
+		if err == nil && len(couriers) != 1 {
+			t.Errorf("run sees %d active couriers, want 1", len(couriers))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,165 @@
+package queries
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"yaa/internal/domain"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// benchSizes are the batch sizes the import benchmarks run with.
+var benchSizes = []int{1000, 10000}
+
+// benchChunk is the chunk size of the streamed variants, as POST /couriers
+// and POST /orders flush them.
+const benchChunk = 1000
+
+// BenchmarkAddCouriers compares one INSERT per row, as imports used to work,
+// with the bulk path, whole and streamed in chunks.
+func BenchmarkAddCouriers(b *testing.B) {
+	q, pool := testDB(b)
+	for _, n := range benchSizes {
+		couriers := benchCouriers(n)
+		b.Run(fmt.Sprintf("row_by_row/%d", n), func(b *testing.B) {
+			benchImport(b, pool, func(ctx context.Context) error { return insertCouriersRowByRow(ctx, pool, couriers) })
+		})
+		b.Run(fmt.Sprintf("bulk/%d", n), func(b *testing.B) {
+			benchImport(b, pool, func(ctx context.Context) error {
+				_, err := q.AddCouriers(ctx, couriers, domain.ImportStrict)
+				return err
+			})
+		})
+		b.Run(fmt.Sprintf("chunked/%d", n), func(b *testing.B) {
+			benchImport(b, pool, func(ctx context.Context) error {
+				_, err := q.AddCouriersFrom(ctx, func(flush func(chunk []domain.Courier) error) error {
+					for i := 0; i < n; i += benchChunk {
+						if err := flush(couriers.Couriers[i:min(i+benchChunk, n)]); err != nil {
+							return err
+						}
+					}
+					return nil
+				}, domain.ImportStrict)
+				return err
+			})
+		})
+	}
+}
+
+// BenchmarkAddOrders is BenchmarkAddCouriers for orders.
+func BenchmarkAddOrders(b *testing.B) {
+	q, pool := testDB(b)
+	for _, n := range benchSizes {
+		orders := benchOrders(n)
+		b.Run(fmt.Sprintf("row_by_row/%d", n), func(b *testing.B) {
+			benchImport(b, pool, func(ctx context.Context) error { return insertOrdersRowByRow(ctx, pool, orders) })
+		})
+		b.Run(fmt.Sprintf("bulk/%d", n), func(b *testing.B) {
+			benchImport(b, pool, func(ctx context.Context) error {
+				_, err := q.AddOrders(ctx, orders, domain.ImportStrict)
+				return err
+			})
+		})
+		b.Run(fmt.Sprintf("chunked/%d", n), func(b *testing.B) {
+			benchImport(b, pool, func(ctx context.Context) error {
+				_, err := q.AddOrdersFrom(ctx, func(flush func(chunk []domain.Order) error) error {
+					for i := 0; i < n; i += benchChunk {
+						if err := flush(orders.Orders[i:min(i+benchChunk, n)]); err != nil {
+							return err
+						}
+					}
+					return nil
+				}, domain.ImportStrict)
+				return err
+			})
+		})
+	}
+}
+
+// benchImport times run on empty tables.
+func benchImport(b *testing.B, pool *pgxpool.Pool, run func(ctx context.Context) error) {
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		if _, err := pool.Exec(ctx, "TRUNCATE couriers, orders CASCADE"); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		if err := run(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func benchCouriers(n int) domain.CourierSl {
+	types := []string{"FOOT", "BIKE", "AUTO"}
+	res := domain.CourierSl{Couriers: make([]domain.Courier, n)}
+	for i := range res.Couriers {
+		res.Couriers[i] = domain.Courier{
+			Id:        int64(i + 1),
+			Type:      types[i%len(types)],
+			Regions:   []int32{int32(i%20 + 1), int32(i%7 + 21)},
+			WorkHours: []domain.TimeInterval{{Start: 9 * 60, End: 13 * 60}, {Start: 14 * 60, End: 18 * 60}},
+		}
+	}
+	return res
+}
+
+func benchOrders(n int) domain.OrderSl {
+	res := domain.OrderSl{Orders: make([]domain.Order, n)}
+	for i := range res.Orders {
+		res.Orders[i] = domain.Order{
+			Id:         int64(i + 1),
+			DelivHours: []domain.TimeInterval{{Start: 10*60 + i%120, End: 12*60 + i%120}},
+			Cost:       int32(100 + i%900),
+			Regions:    int32(i%20 + 1),
+			Weight:     float32(i%400)/10 + 0.1,
+		}
+	}
+	return res
+}
+
+func insertCouriersRowByRow(ctx context.Context, pool *pgxpool.Pool, couriers domain.CourierSl) error {
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		for _, v := range couriers.Couriers {
+			_, err := tx.Exec(ctx, "INSERT INTO couriers (id, cour_type, regions, working_hours) VALUES ($1, $2, $3, $4)",
+				v.Id, v.Type, v.Regions, toRanges(v.WorkHours))
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, `INSERT INTO courier_type_history (courier_id, cour_type, valid_from)
+			VALUES ($1, $2, '-infinity')`, v.Id, v.Type)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func insertOrdersRowByRow(ctx context.Context, pool *pgxpool.Pool, orders domain.OrderSl) error {
+	return pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		for _, v := range orders.Orders {
+			_, err := tx.Exec(ctx, "INSERT INTO orders (id, delivery_hours, cost, regions, weight) VALUES ($1, $2, $3, $4, $5)",
+				v.Id, toRanges(v.DelivHours), v.Cost, v.Regions, v.Weight)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, `INSERT INTO order_status_history (order_id, to_status, actor)
+			VALUES ($1, 'created', $2)`, v.Id, domain.ActorClient)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -2,26 +2,36 @@ package queries
 
 import (
 	"context"
+	"fmt"
 	"time"
 	"yaa/internal/domain"
 
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
 )
 
 func (r *Queries) GetCourier(ctx context.Context, id int64) (*domain.Courier, error) {
-	query := "SELECT id, cour_type, regions, working_hours FROM couriers where id = $1"
+	query := "SELECT id, cour_type, regions, working_hours, deactivated_at, version FROM couriers where id = $1"
 	rows := r.pool.QueryRow(ctx, query, id)
 	var c domain.Courier
-	err := rows.Scan(&c.Id, &c.Type, &c.Regions, &c.WorkHours)
+	err := rows.Scan(&c.Id, &c.Type, &c.Regions, scanIntervals(&c.WorkHours), &c.DeactivatedAt, &c.Version)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("courier %d: %w", id, wrapErr(err))
 	}
 	return &c, nil
 }
 
-func (r *Queries) GetCouriers(ctx context.Context, offset, limit int) ([]domain.Courier, error) {
-	query := "SELECT id, cour_type, regions, working_hours FROM couriers ORDER BY id OFFSET $1 LIMIT $2"
-	rows, err := r.pool.Query(ctx, query, offset, limit)
+// GetCouriers returns up to p.Limit+1 couriers matching f, the extra row
+// telling the caller whether a next page exists.
+func (r *Queries) GetCouriers(ctx context.Context, f domain.CourierFilter, p domain.PageRequest) ([]domain.Courier, error) {
+	w := courierWhere(f)
+	tail, err := page(w, p, courierSortColumns)
+	if err != nil {
+		return nil, err
+	}
+	query := "SELECT id, cour_type, regions, working_hours, deactivated_at, version FROM couriers" + w.String() + tail
+	rows, err := r.pool.Query(ctx, query, w.args...)
 	if err != nil {
 		return nil, err
 	}
@@ -31,22 +41,46 @@ func (r *Queries) GetCouriers(ctx context.Context, offset, limit int) ([]domain.
 
 	for rows.Next() {
 		var c domain.Courier
-		err = rows.Scan(&c.Id, &c.Type, &c.Regions, &c.WorkHours)
+		err = rows.Scan(&c.Id, &c.Type, &c.Regions, scanIntervals(&c.WorkHours), &c.DeactivatedAt, &c.Version)
 		if err != nil {
 			return nil, err
 		}
 		cours = append(cours, c)
 	}
-	return cours, nil
+	return cours, rows.Err()
 }
 
-func (r *Queries) AddCouriers(ctx context.Context, couriers domain.CourierSl) error {
-	tx, err := r.pool.Begin(ctx)
-	if err != nil {
-		return err
-	}
+func (r *Queries) CountCouriers(ctx context.Context, f domain.CourierFilter) (int64, error) {
+	w := courierWhere(f)
+	var n int64
+	err := r.pool.QueryRow(ctx, "SELECT count(*) FROM couriers"+w.String(), w.args...).Scan(&n)
+	return n, err
+}
 
+// sinceAlways is the valid_from of a courier's first type.
+var sinceAlways = pgtype.Timestamptz{Status: pgtype.Present, InfinityModifier: pgtype.NegativeInfinity}
+
+// AddCouriers imports the batch in one transaction, treating couriers that
+// already exist as mode says.
+func (r *Queries) AddCouriers(ctx context.Context, couriers domain.CourierSl, mode domain.ImportMode) (domain.ImportResult, error) {
+	return r.AddCouriersFrom(ctx, func(flush func(chunk []domain.Courier) error) error {
+		return flush(couriers.Couriers)
+	}, mode)
+}
+
+// AddCouriersFrom imports the chunks of feed in one transaction, treating
+// couriers that already exist as mode says. The transaction begins with the
+// first chunk, so a body that never gets one holds no connection. New
+// couriers are copied in bulk and updates are pipelined, so each chunk takes
+// a few round trips. A strict import that meets existing ids reads on to
+// report all of them and then rolls back.
+func (r *Queries) AddCouriersFrom(ctx context.Context, feed domain.CourierFeed, mode domain.ImportMode) (res domain.ImportResult, err error) {
+	res = domain.NewImportResult()
+	var tx pgx.Tx
 	defer func() {
+		if tx == nil {
+			return
+		}
 		if err != nil {
 			tx.Rollback(ctx)
 			return
@@ -54,91 +88,357 @@ func (r *Queries) AddCouriers(ctx context.Context, couriers domain.CourierSl) er
 		err = tx.Commit(ctx)
 	}()
 
-	stmt, err := tx.Prepare(ctx, "prod", `INSERT INTO couriers (id, cour_type, regions,
-	working_hours) VALUES ($1, $2, $3, $4)`)
+	dup := &domain.DuplicateError{}
+	n := 0
+	err = feed(func(chunk []domain.Courier) (err error) {
+		if tx == nil {
+			if tx, err = r.pool.Begin(ctx); err != nil {
+				return err
+			}
+		}
+		offset := n
+		n += len(chunk)
+		return addCouriers(ctx, tx, chunk, offset, mode, dup, &res)
+	})
+	if err == nil && len(dup.IDs) > 0 {
+		err = dup
+	}
+	return res, err
+}
+
+// addCouriers imports one chunk inside tx; offset is the index of its first
+// item in the batch. Once a strict import has met existing ids it only
+// collects the rest of them in dup.
+func addCouriers(ctx context.Context, tx pgx.Tx, couriers []domain.Courier, offset int, mode domain.ImportMode,
+	dup *domain.DuplicateError, res *domain.ImportResult) error {
+	ids := make([]int64, 0, len(couriers))
+	for _, v := range couriers {
+		ids = append(ids, v.Id)
+	}
+	rows, err := tx.Query(ctx, "SELECT id, cour_type::text, deactivated_at FROM couriers WHERE id = ANY($1) FOR UPDATE", ids)
 	if err != nil {
 		return err
 	}
-	for _, v := range couriers.Couriers {
-		_, err := tx.Exec(ctx, stmt.SQL, v.Id, v.Type, v.Regions, v.WorkHours)
+	existing := make(map[int64]domain.Courier)
+	for rows.Next() {
+		var c domain.Courier
+		err = rows.Scan(&c.Id, &c.Type, &c.DeactivatedAt)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		existing[c.Id] = c
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if mode == domain.ImportStrict && len(existing) > 0 {
+		duplicates(dup, offset, ids, func(id int64) bool { _, ok := existing[id]; return ok })
+	}
+	if len(dup.IDs) > 0 {
+		return nil
+	}
+
+	var created, updates []domain.Courier
+	for _, v := range couriers {
+		cur, ok := existing[v.Id]
+		switch {
+		case !ok:
+			created = append(created, v)
+		case mode == domain.ImportSkipExisting || cur.DeactivatedAt != nil:
+			res.Skipped = append(res.Skipped, v.Id)
+		default:
+			updates = append(updates, v)
+		}
+	}
+
+	if len(created) > 0 {
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"couriers"}, []string{"id", "cour_type", "regions", "working_hours"},
+			pgx.CopyFromSlice(len(created), func(i int) ([]interface{}, error) {
+				v := created[i]
+				return []interface{}{v.Id, v.Type, v.Regions, toRanges(v.WorkHours)}, nil
+			}))
+		if err != nil {
+			return wrapErr(err)
+		}
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"courier_type_history"}, []string{"courier_id", "cour_type", "valid_from"},
+			pgx.CopyFromSlice(len(created), func(i int) ([]interface{}, error) {
+				return []interface{}{created[i].Id, created[i].Type, sinceAlways}, nil
+			}))
 		if err != nil {
 			return err
 		}
+		for _, v := range created {
+			res.Created = append(res.Created, v.Id)
+		}
+	}
+
+	if len(updates) > 0 {
+		batch := &pgx.Batch{}
+		for _, v := range updates {
+			batch.Queue(`UPDATE couriers SET cour_type = $2::courier_type, regions = $3,
+				working_hours = $4::int4multirange, version = version + 1
+			WHERE id = $1 AND (cour_type, regions, working_hours)
+				IS DISTINCT FROM ($2::courier_type, $3::int4[], $4::int4multirange)`,
+				v.Id, v.Type, v.Regions, toRanges(v.WorkHours))
+		}
+		results := tx.SendBatch(ctx, batch)
+		var retyped []int64
+		for _, v := range updates {
+			var tag pgconn.CommandTag
+			tag, err = results.Exec()
+			if err != nil {
+				results.Close()
+				return err
+			}
+			if tag.RowsAffected() == 0 {
+				res.Skipped = append(res.Skipped, v.Id)
+				continue
+			}
+			if existing[v.Id].Type != v.Type {
+				retyped = append(retyped, v.Id)
+			}
+			res.Updated = append(res.Updated, v.Id)
+		}
+		if err = results.Close(); err != nil {
+			return err
+		}
+		if len(retyped) > 0 {
+			_, err = tx.Exec(ctx, `INSERT INTO courier_type_history (courier_id, cour_type, valid_from)
+			SELECT id, cour_type, now() FROM couriers WHERE id = ANY($1)`, retyped)
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
-func (r *Queries) CouriersMeta(ctx context.Context, start, end time.Time, courID int64) (error, domain.Rating) {
-	res := domain.Rating{}
-	err, earn := r.getEarn(ctx, start, end, courID)
+// UpdateCourier applies patch if the courier's version matches and returns
+// the new state. Type changes are recorded in courier_type_history.
+func (r *Queries) UpdateCourier(ctx context.Context, id int64, match domain.VersionMatch, patch domain.CourierPatch) (_ *domain.Courier, err error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+
+	current, err := lockCourier(ctx, tx, id, match)
+	if err != nil {
+		return nil, err
+	}
+	if current.DeactivatedAt != nil {
+		return nil, fmt.Errorf("courier %d is deactivated: %w", id, domain.ErrConflict)
+	}
+
+	if patch.Type != nil && *patch.Type != current.Type {
+		effective := time.Now()
+		if patch.EffectiveFrom != nil {
+			effective = *patch.EffectiveFrom
+		}
+		var overlaps bool
+		err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM courier_type_history
+		WHERE courier_id = $1 AND valid_from >= $2)`, id, effective).Scan(&overlaps)
+		if err != nil {
+			return nil, err
+		}
+		if overlaps {
+			err = fmt.Errorf("courier %d: effective_from must be after the last type change: %w", id, domain.ErrValidation)
+			return nil, err
+		}
+		_, err = tx.Exec(ctx, "INSERT INTO courier_type_history (courier_id, cour_type, valid_from) VALUES ($1, $2, $3)",
+			id, *patch.Type, effective)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var workHours interface{}
+	if patch.WorkHours != nil {
+		workHours = toRanges(*patch.WorkHours)
+	}
+	query := `UPDATE couriers SET
+		cour_type = COALESCE($2::courier_type, cour_type),
+		regions = COALESCE($3::int4[], regions),
+		working_hours = COALESCE($4::int4multirange, working_hours),
+		version = version + 1
+	WHERE id = $1
+	RETURNING id, cour_type, regions, working_hours, deactivated_at, version`
+	var c domain.Courier
+	err = tx.QueryRow(ctx, query, id, patch.Type, patch.Regions, workHours).Scan(&c.Id, &c.Type, &c.Regions,
+		scanIntervals(&c.WorkHours), &c.DeactivatedAt, &c.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// DeactivateCourier marks the courier inactive if its version matches and
+// returns its not yet completed orders to the unassigned pool. Completed
+// orders stay attributed to the courier. It takes the assignment lock so that
+// a run which read the courier as active cannot plan trips for it afterwards.
+func (r *Queries) DeactivateCourier(ctx context.Context, id int64, match domain.VersionMatch) (err error) {
+	tx, err := r.pool.Begin(ctx)
 	if err != nil {
-		return err, res
+		return err
 	}
-	err, rating := r.getRating(ctx, start, end, courID)
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+
+	if err = lockAssignments(ctx, tx); err != nil {
+		return err
+	}
+	current, err := lockCourier(ctx, tx, id, match)
 	if err != nil {
-		return err, res
+		return err
+	}
+	if current.DeactivatedAt != nil {
+		return nil
+	}
+
+	// Orders the courier has not picked up yet go back to the pool.
+	rows, err := tx.Query(ctx, `SELECT o.id, o.status::text FROM orders o
+	JOIN group_orders go ON go.order_id = o.id
+	JOIN delivery_groups g ON g.id = go.group_id
+	WHERE g.courier_id = $1 AND o.status IN ('assigned', 'in_delivery')
+	ORDER BY o.id
+	FOR UPDATE OF o`, id)
+	if err != nil {
+		return err
+	}
+	var pending []domain.OrderTransition
+	for rows.Next() {
+		t := domain.OrderTransition{To: domain.OrderCreated, Actor: domain.ActorSystem, CourierID: &id}
+		err = rows.Scan(&t.OrderID, &t.From)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, t)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
 	}
-	res.Earn, res.CourRating = earn, rating
-	return err, res
+	for _, t := range pending {
+		if t.From == domain.OrderInDelivery {
+			err = fmt.Errorf("courier %d is delivering order %d: %w", id, t.OrderID, domain.ErrConflict)
+			return err
+		}
+	}
+	for _, t := range pending {
+		_, err = applyTransition(ctx, tx, t)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(ctx, "UPDATE couriers SET deactivated_at = now(), version = version + 1 WHERE id = $1", id)
+	return err
 }
 
-func (r *Queries) getRating(ctx context.Context, start, end time.Time, courID int64) (error, float32) {
-	query := `with cour_type as (
-	select id, cour_type,
-	case 
-		when c.cour_type = 'AUTO' then 1.0
-		when c.cour_type = 'BIKE' then 2.0
-		when c.cour_type = 'FOOT' then 3.0
-		else 0
-		end as type_category
-	from couriers c where id = $3
-)
-SELECT ((COUNT(*) / EXTRACT(EPOCH FROM (CAST($2 AS timestamp) - CAST($1 AS timestamp))/3600)) * cour_type.type_category)::float4 AS orders_per_hour
-FROM complete_orders
-JOIN cour_type ON complete_orders.courier_id = cour_type.id
-WHERE courier_id = $3 AND completed_time >= $1 AND completed_time < $2
-GROUP BY cour_type.type_category;`
-
-	row := r.pool.QueryRow(ctx, query, start, end, courID)
-	var result pgtype.Float4
-	err := row.Scan(&result)
+// lockCourier locks the courier row for the rest of tx and checks that the
+// caller saw the current version.
+func lockCourier(ctx context.Context, tx pgx.Tx, id int64, match domain.VersionMatch) (domain.Courier, error) {
+	var c domain.Courier
+	err := tx.QueryRow(ctx, "SELECT id, cour_type, deactivated_at, version FROM couriers WHERE id = $1 FOR UPDATE", id).
+		Scan(&c.Id, &c.Type, &c.DeactivatedAt, &c.Version)
 	if err != nil {
-		return err, 0.0
+		return c, fmt.Errorf("courier %d: %w", id, wrapErr(err))
 	}
-	if result.Status == pgtype.Null {
-		return nil, 0.0
+	if !match.Matches(c.Version) {
+		return c, fmt.Errorf("courier %d is at version %d, which If-Match does not list: %w", id, c.Version,
+			domain.ErrPreconditionFailed)
 	}
-	return err, result.Float
+	return c, nil
 }
-func (r *Queries) getEarn(ctx context.Context, start, end time.Time, courID int64) (error, float32) {
-
-	query := `
-		with cour_type as (
-					select id, cour_type,              
-					case 
-									when c.cour_type = 'AUTO' then 4.0
-									when c.cour_type = 'BIKE' then 3.0
-									when c.cour_type = 'FOOT' then 2.0
-									else 0
-									end as type_category
-					from couriers c where id = $3
-	)         
-
-	SELECT SUM(o.cost * cour_type.type_category)::float4 as total_cost
+
+func (r *Queries) CourierStats(ctx context.Context, start, end time.Time, courID int64) (domain.CourierStats, error) {
+	// An order of a group took from the previous completion in that group, or
+	// from the start of the trip for the first one. Earlier completions are
+	// read too so that the first order of the window has its predecessor.
+	query := `WITH done AS (
+		SELECT co.completed_time, o.cost,
+			CASE WHEN g.id IS NOT NULL THEN co.completed_time - COALESCE(
+				lag(co.completed_time) OVER (PARTITION BY g.id ORDER BY co.completed_time), g.start_time)
+			END AS took
+		FROM complete_orders co
+		JOIN orders o ON co.order_id = o.id
+		LEFT JOIN group_orders go ON go.order_id = o.id
+		LEFT JOIN delivery_groups g ON g.id = go.group_id
+		WHERE co.courier_id = $3 AND co.completed_time < $2
+	)
+	SELECT COUNT(*), COALESCE(SUM(cost), 0), AVG(EXTRACT(EPOCH FROM took) / 60)::float8
+	FROM done
+	WHERE completed_time >= $1`
+
+	var stats domain.CourierStats
+	err := r.pool.QueryRow(ctx, query, start, end, courID).Scan(&stats.Completed, &stats.TotalCost,
+		&stats.AvgDeliveryMinutes)
+	if err != nil {
+		return domain.CourierStats{}, err
+	}
+
+	breakdownQuery := `SELECT o.regions, h.cour_type, COUNT(*), SUM(o.cost)
 	FROM complete_orders co
 	JOIN orders o ON co.order_id = o.id
-	JOIN cour_type ON co.courier_id = cour_type.id
-	WHERE co.courier_id = $3 AND co.completed_time >= $1 AND co.completed_time < $2;`
+	JOIN LATERAL (
+		SELECT cour_type FROM courier_type_history h
+		WHERE h.courier_id = co.courier_id AND h.valid_from <= co.completed_time
+		ORDER BY h.valid_from DESC
+		LIMIT 1
+	) h ON true
+	WHERE co.courier_id = $3 AND co.completed_time >= $1 AND co.completed_time < $2
+	GROUP BY o.regions, h.cour_type
+	ORDER BY o.regions, h.cour_type`
 
-	row := r.pool.QueryRow(ctx, query, start, end, courID)
-	var result pgtype.Float4
-	err := row.Scan(&result)
+	rows, err := r.pool.Query(ctx, breakdownQuery, start, end, courID)
+	if err != nil {
+		return domain.CourierStats{}, err
+	}
+	defer rows.Close()
 
+	for rows.Next() {
+		var rs domain.TypeRegionStats
+		err = rows.Scan(&rs.Region, &rs.Type, &rs.Completed, &rs.TotalCost)
+		if err != nil {
+			return domain.CourierStats{}, err
+		}
+		stats.Breakdown = append(stats.Breakdown, rs)
+	}
+	return stats, rows.Err()
+}
+
+func (r *Queries) GetAllCouriers(ctx context.Context) ([]domain.Courier, error) {
+	query := "SELECT id, cour_type, regions, working_hours FROM couriers WHERE deactivated_at IS NULL ORDER BY id"
+	rows, err := r.pool.Query(ctx, query)
 	if err != nil {
-		return err, 0.0
+		return nil, err
 	}
-	if result.Status == pgtype.Null {
-		return nil, 0.0
+	defer rows.Close()
+
+	var cours []domain.Courier
+
+	for rows.Next() {
+		var c domain.Courier
+		err = rows.Scan(&c.Id, &c.Type, &c.Regions, scanIntervals(&c.WorkHours))
+		if err != nil {
+			return nil, err
+		}
+		cours = append(cours, c)
 	}
-	return err, result.Float
+	return cours, rows.Err()
 }
@@ -0,0 +1,81 @@
+package queries
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"yaa/internal/domain"
+)
+
+func TestUpdateAndDeactivateCourier(t *testing.T) {
+	q, _ := testDB(t)
+	ctx := context.Background()
+
+	iv, err := domain.ParseTimeInterval("09:00-18:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = q.AddCouriers(ctx, domain.CourierSl{Couriers: []domain.Courier{
+		{Id: 1, Type: "FOOT", Regions: []int32{1}, WorkHours: []domain.TimeInterval{iv}},
+	}}, domain.ImportStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	str := func(s string) *string { return &s }
+	at := func(s string) *time.Time {
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &ts
+	}
+	versions := func(v ...int64) domain.VersionMatch { return domain.VersionMatch{Versions: v} }
+	anyVersion := domain.VersionMatch{Any: true}
+
+	steps := []struct {
+		name        string
+		match       domain.VersionMatch
+		patch       *domain.CourierPatch // nil deactivates
+		wantErr     error
+		wantVersion int64
+	}{
+		{"stale version", versions(0), &domain.CourierPatch{Type: str("BIKE")}, domain.ErrPreconditionFailed, 0},
+		{"current version", versions(1), &domain.CourierPatch{Type: str("BIKE"),
+			EffectiveFrom: at("2023-05-01T00:00:00Z")}, nil, 2},
+		{"effective_from before the last type change", versions(2), &domain.CourierPatch{Type: str("AUTO"),
+			EffectiveFrom: at("2023-04-01T00:00:00Z")}, domain.ErrValidation, 0},
+		{"effective_from at the last type change", versions(2), &domain.CourierPatch{Type: str("AUTO"),
+			EffectiveFrom: at("2023-05-01T00:00:00Z")}, domain.ErrValidation, 0},
+		{"effective_from after the last type change", versions(1, 2), &domain.CourierPatch{Type: str("AUTO"),
+			EffectiveFrom: at("2023-05-02T00:00:00Z")}, nil, 3},
+		{"any version", anyVersion, &domain.CourierPatch{Regions: &[]int32{2}}, nil, 4},
+		{"deactivate with a stale version", versions(3), nil, domain.ErrPreconditionFailed, 0},
+		{"deactivate", versions(4), nil, nil, 0},
+		{"deactivate again", anyVersion, nil, nil, 0},
+		{"update a deactivated courier", anyVersion, &domain.CourierPatch{Type: str("FOOT")}, domain.ErrConflict, 0},
+	}
+	for _, s := range steps {
+		if s.patch == nil {
+			err = q.DeactivateCourier(ctx, 1, s.match)
+		} else {
+			var c *domain.Courier
+			c, err = q.UpdateCourier(ctx, 1, s.match, *s.patch)
+			if err == nil && c.Version != s.wantVersion {
+				t.Errorf("%s: version %d, want %d", s.name, c.Version, s.wantVersion)
+			}
+		}
+		if !errors.Is(err, s.wantErr) {
+			t.Errorf("%s: err = %v, want %v", s.name, err, s.wantErr)
+		}
+	}
+
+	c, err := q.GetCourier(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.DeactivatedAt == nil || c.Type != "AUTO" {
+		t.Errorf("courier after the steps: %+v", c)
+	}
+}
@@ -0,0 +1,65 @@
+package queries
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+	"yaa/migrations"
+	"yaa/pkg/migrate"
+	"yaa/pkg/postgres"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/sirupsen/logrus"
+)
+
+// testDSNEnv names the database the tests in this package run against. They
+// are skipped when it is unset.
+const testDSNEnv = "YAA_TEST_POSTGRES_DSN"
+
+// testDB migrates a scratch schema and returns queries and the pool bound to
+// it. The schema is dropped when tb finishes.
+func testDB(tb testing.TB) (*Queries, *pgxpool.Pool) {
+	tb.Helper()
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		tb.Skipf("%s is not set", testDSNEnv)
+	}
+	ctx := context.Background()
+
+	admin, err := postgres.NewPool(postgres.Config{DSN: dsn})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(admin.Close)
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err = admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		if _, err := admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			tb.Errorf("drop schema %s: %v", schema, err)
+		}
+	})
+
+	// Enum types already in public stay visible; missing ones land in the
+	// scratch schema.
+	pool, err := postgres.NewPool(postgres.Config{DSN: dsn, SearchPath: schema + ",public"})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(pool.Close)
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+	migrator, err := migrate.New(pool, migrations.FS, logger)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err = migrator.Up(ctx); err != nil {
+		tb.Fatal(err)
+	}
+	return New(pool), pool
+}
@@ -0,0 +1,37 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"yaa/internal/domain"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+const uniqueViolation = "23505"
+
+func wrapErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.ErrNotFound
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return fmt.Errorf("%s: %w", pgErr.Detail, domain.ErrConflict)
+	}
+	return err
+}
+
+// duplicates adds to dup the ids of a chunk for which exists is true. offset
+// is the index of the chunk's first item in the batch.
+func duplicates(dup *domain.DuplicateError, offset int, ids []int64, exists func(id int64) bool) {
+	for i, id := range ids {
+		if exists(id) {
+			dup.Index = append(dup.Index, offset+i)
+			dup.IDs = append(dup.IDs, id)
+		}
+	}
+}
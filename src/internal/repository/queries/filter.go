@@ -0,0 +1,157 @@
+package queries
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"yaa/internal/domain"
+
+	"github.com/jackc/pgtype"
+)
+
+var courierSortColumns = map[string]string{
+	"id":   "id",
+	"type": "cour_type",
+}
+
+var orderSortColumns = map[string]string{
+	"id":             "id",
+	"cost":           "cost",
+	"weight":         "weight",
+	"region":         "regions",
+	"completed_time": "completed_time",
+}
+
+// where collects SQL conditions, numbering placeholders as they are added.
+// Values only ever travel as arguments, never inside the SQL text.
+type where struct {
+	conds []string
+	args  []interface{}
+}
+
+// add appends cond with its single "?" replaced by the next placeholder.
+func (w *where) add(cond string, arg interface{}) {
+	w.args = append(w.args, arg)
+	w.conds = append(w.conds, strings.Replace(cond, "?", "$"+strconv.Itoa(len(w.args)), 1))
+}
+
+func (w *where) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
+func courierWhere(f domain.CourierFilter) *where {
+	w := &where{}
+	if !f.IncludeInactive {
+		w.conds = append(w.conds, "deactivated_at IS NULL")
+	}
+	if f.Type != "" {
+		w.add("cour_type = ?", f.Type)
+	}
+	if f.Region != nil {
+		w.add("regions @> ARRAY[?::int4]", *f.Region)
+	}
+	if f.WorkingHours != nil {
+		w.add("working_hours && ?::int4multirange", overlapRanges(*f.WorkingHours))
+	}
+	return w
+}
+
+func orderWhere(f domain.OrderFilter) *where {
+	w := &where{}
+	if f.Region != nil {
+		w.add("regions = ?", *f.Region)
+	}
+	if f.Completed != nil {
+		if *f.Completed {
+			w.conds = append(w.conds, "completed_time IS NOT NULL")
+		} else {
+			w.conds = append(w.conds, "completed_time IS NULL")
+		}
+	}
+	if f.Status != "" {
+		w.add("status = ?::order_status", string(f.Status))
+	}
+	if f.MinWeight != nil {
+		w.add("weight >= ?", *f.MinWeight)
+	}
+	if f.MaxWeight != nil {
+		w.add("weight <= ?", *f.MaxWeight)
+	}
+	if f.MinCost != nil {
+		w.add("cost >= ?", *f.MinCost)
+	}
+	if f.MaxCost != nil {
+		w.add("cost <= ?", *f.MaxCost)
+	}
+	if f.DeliveryHours != nil {
+		w.add("delivery_hours && ?::int4multirange", overlapRanges(*f.DeliveryHours))
+	}
+	if f.CompletedFrom != nil {
+		w.add("completed_time >= ?", *f.CompletedFrom)
+	}
+	if f.CompletedTo != nil {
+		w.add("completed_time < ?", *f.CompletedTo)
+	}
+	return w
+}
+
+// page adds the keyset condition and returns the ORDER BY, OFFSET and LIMIT
+// tail. Rows are always ordered by id last so pages are stable; one extra
+// row is fetched to tell whether a next page exists.
+func page(w *where, p domain.PageRequest, columns map[string]string) (string, error) {
+	sort := p.Sort
+	if sort == "" {
+		sort = domain.SortByID
+	}
+	col, ok := columns[sort]
+	if !ok {
+		return "", fmt.Errorf("cannot sort by %q: %w", sort, domain.ErrValidation)
+	}
+	dir := "ASC"
+	if p.Desc {
+		dir = "DESC"
+	}
+
+	order := " ORDER BY " + col + " " + dir
+	if col != "id" {
+		order += ", id " + dir
+	}
+
+	if p.ByCursor {
+		if sort != domain.SortByID {
+			return "", fmt.Errorf("cursor pagination requires sort by id: %w", domain.ErrValidation)
+		}
+		if p.Desc {
+			w.add("id < ?", p.After)
+		} else {
+			w.add("id > ?", p.After)
+		}
+		w.args = append(w.args, p.Limit+1)
+		return order + " LIMIT $" + strconv.Itoa(len(w.args)), nil
+	}
+
+	w.args = append(w.args, p.Offset, p.Limit+1)
+	return order + " OFFSET $" + strconv.Itoa(len(w.args)-1) + " LIMIT $" + strconv.Itoa(len(w.args)), nil
+}
+
+// overlapRanges returns i together with its copies shifted by a day, so that
+// && matches stored windows the same way domain.TimeInterval.Overlaps does.
+func overlapRanges(i domain.TimeInterval) *pgtype.Int4multirange {
+	lo, hi := i.Bounds()
+	elems := make([]pgtype.Int4range, 0, 3)
+	for _, shift := range []int{-24 * 60, 0, 24 * 60} {
+		elems = append(elems, pgtype.Int4range{
+			Lower:     pgtype.Int4{Int: int32(lo + shift), Status: pgtype.Present},
+			Upper:     pgtype.Int4{Int: int32(hi + shift), Status: pgtype.Present},
+			LowerType: pgtype.Inclusive,
+			UpperType: pgtype.Exclusive,
+			Status:    pgtype.Present,
+		})
+	}
+	var res pgtype.Int4multirange
+	res.Set(elems)
+	return &res
+}
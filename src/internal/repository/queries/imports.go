@@ -0,0 +1,118 @@
+package queries
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"yaa/internal/domain"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+const importJobColumns = `id, format, mode, status, attempts, total_rows, processed_rows, created_rows, updated_rows,
+	skipped_rows, failed_rows, row_errors, COALESCE(error, ''), created_at, started_at, finished_at`
+
+func scanImportJob(row pgx.Row, j *domain.ImportJob) error {
+	return row.Scan(&j.Id, &j.Format, &j.Mode, &j.Status, &j.Attempts, &j.TotalRows, &j.ProcessedRows, &j.Created, &j.Updated,
+		&j.Skipped, &j.Failed, &j.Errors, &j.Error, &j.CreatedAt, &j.StartedAt, &j.FinishedAt)
+}
+
+func (r *Queries) CreateImportJob(ctx context.Context, format string, mode domain.ImportMode, payload []byte) (domain.ImportJob, error) {
+	var j domain.ImportJob
+	err := scanImportJob(r.pool.QueryRow(ctx, `INSERT INTO import_jobs (format, mode, payload)
+	VALUES ($1, $2, $3) RETURNING `+importJobColumns, format, string(mode), payload), &j)
+	return j, err
+}
+
+func (r *Queries) GetImportJob(ctx context.Context, id int64) (domain.ImportJob, error) {
+	var j domain.ImportJob
+	err := scanImportJob(r.pool.QueryRow(ctx, "SELECT "+importJobColumns+" FROM import_jobs WHERE id = $1", id), &j)
+	if err != nil {
+		return j, fmt.Errorf("import %d: %w", id, wrapErr(err))
+	}
+	return j, nil
+}
+
+// ClaimImportJob marks the oldest queued job as running and returns it with
+// its file. Running jobs whose heartbeat is older than lease belong to a
+// worker that went away and are claimed again. Each claim counts an attempt,
+// which fences off the updates of earlier ones. It returns a nil job when
+// there is nothing to do.
+func (r *Queries) ClaimImportJob(ctx context.Context, lease time.Duration) (*domain.ImportJob, []byte, error) {
+	var (
+		j       domain.ImportJob
+		payload []byte
+	)
+	err := r.pool.QueryRow(ctx, `UPDATE import_jobs SET status = 'running', attempts = attempts + 1,
+		started_at = COALESCE(started_at, now()), heartbeat_at = now()
+	WHERE id = (
+		SELECT id FROM import_jobs
+		WHERE status = 'queued' OR (status = 'running' AND heartbeat_at < now() - $1::interval)
+		ORDER BY id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING payload, `+importJobColumns, lease).Scan(&payload, &j.Id, &j.Format, &j.Mode, &j.Status, &j.Attempts, &j.TotalRows,
+		&j.ProcessedRows, &j.Created, &j.Updated, &j.Skipped, &j.Failed, &j.Errors, &j.Error, &j.CreatedAt,
+		&j.StartedAt, &j.FinishedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &j, payload, nil
+}
+
+// SaveImportProgress stores the counters of a running job and renews its
+// lease. The attempt of j identifies the claim; once another worker has
+// claimed the job again it fails with ErrConflict.
+func (r *Queries) SaveImportProgress(ctx context.Context, j domain.ImportJob) error {
+	tag, err := r.pool.Exec(ctx, `UPDATE import_jobs SET total_rows = $2, processed_rows = $3, created_rows = $4,
+		updated_rows = $5, skipped_rows = $6, failed_rows = $7, row_errors = $8::jsonb, heartbeat_at = now()
+	WHERE id = $1 AND status = 'running' AND attempts = $9`,
+		j.Id, j.TotalRows, j.ProcessedRows, j.Created, j.Updated, j.Skipped, j.Failed, j.Errors, j.Attempts)
+	return claimed(tag, err, j.Id, j.Attempts)
+}
+
+// RenewImportLease moves the heartbeat of attempt of a running job to now.
+// It fails with ErrConflict once another worker has claimed the job again.
+func (r *Queries) RenewImportLease(ctx context.Context, id int64, attempt int) error {
+	tag, err := r.pool.Exec(ctx, `UPDATE import_jobs SET heartbeat_at = now()
+	WHERE id = $1 AND attempts = $2 AND status = 'running'`, id, attempt)
+	return claimed(tag, err, id, attempt)
+}
+
+// FinishImportJob records the outcome of attempt of a running job. It fails
+// with ErrConflict if that attempt is no longer running, for example because
+// another worker took the job over.
+func (r *Queries) FinishImportJob(ctx context.Context, id int64, attempt int, status domain.ImportJobStatus,
+	msg string) error {
+	tag, err := r.pool.Exec(ctx, `UPDATE import_jobs SET status = $3, error = NULLIF($4, ''), finished_at = now(),
+		heartbeat_at = NULL, payload = ''
+	WHERE id = $1 AND attempts = $2 AND status = 'running'`, id, attempt, string(status), msg)
+	return claimed(tag, err, id, attempt)
+}
+
+// RequeueImportJob hands attempt of a running job back to the queue, for
+// example when the worker shuts down. It fails with ErrConflict if another
+// worker took the job over.
+func (r *Queries) RequeueImportJob(ctx context.Context, id int64, attempt int) error {
+	tag, err := r.pool.Exec(ctx, `UPDATE import_jobs SET status = 'queued', heartbeat_at = NULL
+	WHERE id = $1 AND attempts = $2 AND status = 'running'`, id, attempt)
+	return claimed(tag, err, id, attempt)
+}
+
+// claimed turns an update of an import job that matched no row into
+// ErrConflict.
+func claimed(tag pgconn.CommandTag, err error, id int64, attempt int) error {
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("import %d attempt %d is no longer running: %w", id, attempt, domain.ErrConflict)
+	}
+	return nil
+}
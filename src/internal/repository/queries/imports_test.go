@@ -0,0 +1,108 @@
+package queries
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"yaa/internal/domain"
+)
+
+func TestImportJobTakeover(t *testing.T) {
+	q, _ := testDB(t)
+	ctx := context.Background()
+
+	if _, err := q.CreateImportJob(ctx, "ndjson", domain.ImportStrict, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	first, _, err := q.ClaimImportJob(ctx, time.Hour)
+	if err != nil || first == nil {
+		t.Fatalf("first claim: %v, %v", first, err)
+	}
+	if again, _, err := q.ClaimImportJob(ctx, time.Hour); err != nil || again != nil {
+		t.Fatalf("claimed a job within its lease: %v, %v", again, err)
+	}
+
+	// The first worker stalls past its lease and a second one takes over.
+	time.Sleep(10 * time.Millisecond)
+	second, _, err := q.ClaimImportJob(ctx, time.Millisecond)
+	if err != nil || second == nil || second.Id != first.Id {
+		t.Fatalf("takeover: %v, %v", second, err)
+	}
+	if second.Attempts != first.Attempts+1 {
+		t.Fatalf("takeover is attempt %d, want %d", second.Attempts, first.Attempts+1)
+	}
+
+	iv, err := domain.ParseTimeInterval("10:00-12:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders := []domain.Order{{Id: 1, Weight: 1, Regions: 1, Cost: 10, DelivHours: []domain.TimeInterval{iv}}}
+	stale := *first
+	stale.ProcessedRows = 1
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"save progress", func() error { return q.SaveImportProgress(ctx, stale) }},
+		{"import a chunk", func() error {
+			return q.InTx(ctx, func(ctx context.Context) error {
+				if _, err := q.AddOrders(ctx, domain.OrderSl{Orders: orders}, stale.Mode); err != nil {
+					return err
+				}
+				return q.SaveImportProgress(ctx, stale)
+			})
+		}},
+		{"finish", func() error { return q.FinishImportJob(ctx, first.Id, first.Attempts, domain.JobSucceeded, "") }},
+		{"requeue", func() error { return q.RequeueImportJob(ctx, first.Id, first.Attempts) }},
+	}
+	for _, s := range steps {
+		if err := s.run(); !errors.Is(err, domain.ErrConflict) {
+			t.Errorf("%s by the stale worker: %v, want %v", s.name, err, domain.ErrConflict)
+		}
+	}
+	if _, err = q.GetOrder(ctx, 1); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("order of the stale chunk: %v, want %v", err, domain.ErrNotFound)
+	}
+
+	if err = q.SaveImportProgress(ctx, *second); err != nil {
+		t.Fatal(err)
+	}
+	if err = q.FinishImportJob(ctx, second.Id, second.Attempts, domain.JobSucceeded, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInTxSurvivesFailedImport(t *testing.T) {
+	q, _ := testDB(t)
+	ctx := context.Background()
+
+	iv, err := domain.ParseTimeInterval("10:00-12:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := func(id int64) domain.Order {
+		return domain.Order{Id: id, Weight: 1, Regions: 1, Cost: 10, DelivHours: []domain.TimeInterval{iv}}
+	}
+	if _, err = q.AddOrders(ctx, domain.OrderSl{Orders: []domain.Order{order(1)}}, domain.ImportStrict); err != nil {
+		t.Fatal(err)
+	}
+
+	// A strict import meeting an existing id rolls back to its savepoint;
+	// the transaction goes on with the rest.
+	err = q.InTx(ctx, func(ctx context.Context) error {
+		_, err := q.AddOrders(ctx, domain.OrderSl{Orders: []domain.Order{order(2), order(1)}}, domain.ImportStrict)
+		var dup *domain.DuplicateError
+		if !errors.As(err, &dup) || len(dup.Index) != 1 || dup.Index[0] != 1 {
+			t.Errorf("strict import: %v, want order 1 at index 1 as a duplicate", err)
+		}
+		_, err = q.AddOrders(ctx, domain.OrderSl{Orders: []domain.Order{order(2)}}, domain.ImportSkipExisting)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = q.GetOrder(ctx, 2); err != nil {
+		t.Errorf("order 2 after commit: %v", err)
+	}
+}
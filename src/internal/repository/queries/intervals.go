@@ -0,0 +1,65 @@
+package queries
+
+import (
+	"yaa/internal/domain"
+
+	"github.com/jackc/pgtype"
+)
+
+// intervals scans an int4multirange column of minutes into []domain.TimeInterval.
+type intervals struct {
+	dst *[]domain.TimeInterval
+}
+
+func scanIntervals(dst *[]domain.TimeInterval) *intervals {
+	return &intervals{dst: dst}
+}
+
+func (i *intervals) DecodeText(ci *pgtype.ConnInfo, src []byte) error {
+	var raw pgtype.Int4multirange
+	if err := raw.DecodeText(ci, src); err != nil {
+		return err
+	}
+	*i.dst = fromRanges(raw)
+	return nil
+}
+
+func (i *intervals) DecodeBinary(ci *pgtype.ConnInfo, src []byte) error {
+	var raw pgtype.Int4multirange
+	if err := raw.DecodeBinary(ci, src); err != nil {
+		return err
+	}
+	*i.dst = fromRanges(raw)
+	return nil
+}
+
+func fromRanges(raw pgtype.Int4multirange) []domain.TimeInterval {
+	if raw.Status != pgtype.Present {
+		return nil
+	}
+	res := make([]domain.TimeInterval, 0, len(raw.Ranges))
+	for _, e := range raw.Ranges {
+		res = append(res, domain.TimeInterval{
+			Start: int(e.Lower.Int) % (24 * 60),
+			End:   int(e.Upper.Int) % (24 * 60),
+		})
+	}
+	return res
+}
+
+func toRanges(src []domain.TimeInterval) *pgtype.Int4multirange {
+	elems := make([]pgtype.Int4range, 0, len(src))
+	for _, i := range src {
+		lo, hi := i.Bounds()
+		elems = append(elems, pgtype.Int4range{
+			Lower:     pgtype.Int4{Int: int32(lo), Status: pgtype.Present},
+			Upper:     pgtype.Int4{Int: int32(hi), Status: pgtype.Present},
+			LowerType: pgtype.Inclusive,
+			UpperType: pgtype.Exclusive,
+			Status:    pgtype.Present,
+		})
+	}
+	var res pgtype.Int4multirange
+	res.Set(elems)
+	return &res
+}
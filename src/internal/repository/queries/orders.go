@@ -2,56 +2,145 @@ package queries
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 	"yaa/internal/domain"
+	"yaa/internal/logging"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 )
 
+// orderColumns selects an order together with the courier whose delivery
+// group currently holds it.
+const orderColumns = `id, delivery_hours, cost, regions, weight, completed_time, status::text,
+	(SELECT g.courier_id FROM group_orders go JOIN delivery_groups g ON g.id = go.group_id WHERE go.order_id = orders.id)`
+
+func scanOrder(row pgx.Row, o *domain.Order) error {
+	return row.Scan(&o.Id, scanIntervals(&o.DelivHours), &o.Cost, &o.Regions, &o.Weight, &o.CompletedTime,
+		&o.Status, &o.CourierID)
+}
+
 func (r *Queries) GetOrder(ctx context.Context, id int64) (*domain.Order, error) {
-	query := "SELECT id, delivery_hours, cost, regions, weight FROM orders where id = $1"
+	query := "SELECT " + orderColumns + " FROM orders where id = $1"
 	rows := r.pool.QueryRow(ctx, query, id)
 
 	var c domain.Order
 
-	err := rows.Scan(&c.Id, &c.DelivHours, &c.Cost, &c.Regions, &c.Weight)
+	err := scanOrder(rows, &c)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("order %d: %w", id, wrapErr(err))
 	}
 
 	return &c, nil
 }
 
-func (r *Queries) GetOrders(ctx context.Context, offset, limit int) (domain.OrderSl, error) {
-	query := "SELECT id, delivery_hours, cost, regions, weight FROM orders ORDER BY id OFFSET $1 LIMIT $2"
-	rows, err := r.pool.Query(ctx, query, offset, limit)
+// GetOrdersByID returns the orders with the given ids in id order; missing
+// ids are left out.
+func (r *Queries) GetOrdersByID(ctx context.Context, ids []int64) ([]domain.Order, error) {
+	query := "SELECT " + orderColumns + " FROM orders WHERE id = ANY($1) ORDER BY id"
+	rows, err := r.pool.Query(ctx, query, ids)
 	if err != nil {
-		return domain.OrderSl{}, err
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []domain.Order
+
+	for rows.Next() {
+		var c domain.Order
+		err = scanOrder(rows, &c)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, c)
+	}
+	return orders, rows.Err()
+}
+
+// GetOrders returns up to p.Limit+1 orders matching f, the extra row telling
+// the caller whether a next page exists.
+func (r *Queries) GetOrders(ctx context.Context, f domain.OrderFilter, p domain.PageRequest) ([]domain.Order, error) {
+	w := orderWhere(f)
+	tail, err := page(w, p, orderSortColumns)
+	if err != nil {
+		return nil, err
+	}
+	query := "SELECT " + orderColumns + " FROM orders" + w.String() + tail
+	rows, err := r.pool.Query(ctx, query, w.args...)
+	if err != nil {
+		return nil, err
 	}
 
 	defer rows.Close()
 
-	var cours domain.OrderSl
+	var orders []domain.Order
 
 	for rows.Next() {
 		var c domain.Order
-		err = rows.Scan(&c.Id, &c.DelivHours, &c.Cost, &c.Regions, &c.Weight)
+		err = scanOrder(rows, &c)
 		if err != nil {
-			return domain.OrderSl{}, err
+			return nil, err
 		}
 
-		cours.Orders = append(cours.Orders, c)
+		orders = append(orders, c)
 	}
 
-	return cours, nil
+	return orders, rows.Err()
 }
 
-func (r *Queries) AddOrders(ctx context.Context, orders domain.OrderSl) error {
-	tx, err := r.pool.Begin(ctx)
+func (r *Queries) CountOrders(ctx context.Context, f domain.OrderFilter) (int64, error) {
+	w := orderWhere(f)
+	var n int64
+	err := r.pool.QueryRow(ctx, "SELECT count(*) FROM orders"+w.String(), w.args...).Scan(&n)
+	return n, err
+}
+
+// GetUnassignedOrders returns the orders waiting for a courier that had been
+// placed by the end of date.
+func (r *Queries) GetUnassignedOrders(ctx context.Context, date time.Time) ([]domain.Order, error) {
+	query := "SELECT " + orderColumns + ` FROM orders
+	WHERE status = 'created' AND COALESCE(
+		(SELECT min(h.changed_at) FROM order_status_history h WHERE h.order_id = orders.id), '-infinity'
+	) < $1::date + 1
+	ORDER BY id`
+	rows, err := r.pool.Query(ctx, query, date)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
+
+	var orders []domain.Order
 
+	for rows.Next() {
+		var c domain.Order
+		err = scanOrder(rows, &c)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, c)
+	}
+	return orders, rows.Err()
+}
+
+// AddOrders imports the batch in one transaction, treating orders that
+// already exist as mode says.
+func (r *Queries) AddOrders(ctx context.Context, orders domain.OrderSl, mode domain.ImportMode) (domain.ImportResult, error) {
+	return r.AddOrdersFrom(ctx, func(flush func(chunk []domain.Order) error) error {
+		return flush(orders.Orders)
+	}, mode)
+}
+
+// AddOrdersFrom imports the chunks of feed in one transaction the way
+// AddCouriersFrom does, treating orders that already exist as mode says.
+func (r *Queries) AddOrdersFrom(ctx context.Context, feed domain.OrderFeed, mode domain.ImportMode) (res domain.ImportResult, err error) {
+	res = domain.NewImportResult()
+	var tx pgx.Tx
 	defer func() {
+		if tx == nil {
+			return
+		}
 		if err != nil {
 			tx.Rollback(ctx)
 			return
@@ -59,66 +148,135 @@ func (r *Queries) AddOrders(ctx context.Context, orders domain.OrderSl) error {
 		err = tx.Commit(ctx)
 	}()
 
-	stmt, err := tx.Prepare(ctx, "insert_ord", `INSERT INTO orders (id, delivery_hours, cost, regions, weight, completed_time) VALUES ($1, $2, $3, $4, $5, $6)`)
+	dup := &domain.DuplicateError{}
+	n := 0
+	err = feed(func(chunk []domain.Order) (err error) {
+		if tx == nil {
+			if tx, err = r.pool.Begin(ctx); err != nil {
+				return err
+			}
+		}
+		offset := n
+		n += len(chunk)
+		return addOrders(ctx, tx, chunk, offset, mode, dup, &res)
+	})
+	if err == nil && len(dup.IDs) > 0 {
+		err = dup
+	}
+	return res, err
+}
+
+// addOrders imports one chunk inside tx; offset is the index of its first
+// item in the batch. Once a strict import has met existing ids it only
+// collects the rest of them in dup.
+func addOrders(ctx context.Context, tx pgx.Tx, orders []domain.Order, offset int, mode domain.ImportMode,
+	dup *domain.DuplicateError, res *domain.ImportResult) error {
+	ids := make([]int64, 0, len(orders))
+	for _, v := range orders {
+		ids = append(ids, v.Id)
+	}
+	rows, err := tx.Query(ctx, "SELECT id, status::text FROM orders WHERE id = ANY($1) FOR UPDATE", ids)
 	if err != nil {
 		return err
 	}
-	for _, v := range orders.Orders {
-		_, err := tx.Exec(ctx, stmt.SQL, v.Id, v.DelivHours, v.Cost, v.Regions, v.Weight, nil)
+	existing := make(map[int64]domain.OrderStatus)
+	for rows.Next() {
+		var (
+			id     int64
+			status domain.OrderStatus
+		)
+		err = rows.Scan(&id, &status)
 		if err != nil {
+			rows.Close()
 			return err
 		}
+		existing[id] = status
 	}
-	return nil
-}
-
-func (r *Queries) CheckOrderStatus(ctx context.Context, ordID int64) (bool, error) {
-	var t time.Time
-
-	rows, err := r.pool.Query(context.Background(), "SELECT completed_time from orders where id=$1", ordID)
-	defer rows.Close()
-	if err != nil {
-		return false, fmt.Errorf("err")
-	}
-	rows.Next()
-	rows.Scan(&t)
-	if !t.IsZero() {
-		err = fmt.Errorf("order already done")
-		return false, err
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
 	}
-	return true, nil
-}
-
-func (r *Queries) ExistOrder(ctx context.Context, courID, orderID int64) (bool, error) {
-	status, err := r.CheckOrderStatus(ctx, orderID)
-
-	if !status {
-		err = fmt.Errorf("order have complete time")
-		return false, err
+	if mode == domain.ImportStrict && len(existing) > 0 {
+		duplicates(dup, offset, ids, func(id int64) bool { _, ok := existing[id]; return ok })
 	}
-	if err != nil {
-		return false, err
+	if len(dup.IDs) > 0 {
+		return nil
 	}
 
-	var existsOrd bool
-	err = r.pool.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM orders WHERE id =$1 )", orderID).Scan(&existsOrd)
-	if err != nil {
-		return false, err
+	var created, updates []domain.Order
+	for _, v := range orders {
+		status, ok := existing[v.Id]
+		switch {
+		case !ok:
+			created = append(created, v)
+		case mode == domain.ImportSkipExisting || status != domain.OrderCreated:
+			res.Skipped = append(res.Skipped, v.Id)
+		default:
+			updates = append(updates, v)
+		}
 	}
 
-	var existsCour bool
-	err = r.pool.QueryRow(context.Background(), "SELECT EXISTS(SELECT 1 FROM couriers WHERE id =$1 )", courID).Scan(&existsCour)
-	if existsCour && existsOrd {
-		return true, nil
+	if len(created) > 0 {
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"orders"}, []string{"id", "delivery_hours", "cost", "regions", "weight"},
+			pgx.CopyFromSlice(len(created), func(i int) ([]interface{}, error) {
+				v := created[i]
+				return []interface{}{v.Id, toRanges(v.DelivHours), v.Cost, v.Regions, v.Weight}, nil
+			}))
+		if err != nil {
+			return wrapErr(err)
+		}
+		var requestID *string
+		if id := logging.RequestID(ctx); id != "" {
+			requestID = &id
+		}
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"order_status_history"}, []string{"order_id", "to_status", "actor", "request_id"},
+			pgx.CopyFromSlice(len(created), func(i int) ([]interface{}, error) {
+				return []interface{}{created[i].Id, string(domain.OrderCreated), domain.ActorClient, requestID}, nil
+			}))
+		if err != nil {
+			return err
+		}
+		for _, v := range created {
+			res.Created = append(res.Created, v.Id)
+		}
 	}
-	return false, nil
 
+	if len(updates) > 0 {
+		batch := &pgx.Batch{}
+		for _, v := range updates {
+			batch.Queue(`UPDATE orders SET delivery_hours = $2::int4multirange, cost = $3, regions = $4, weight = $5
+			WHERE id = $1 AND (delivery_hours, cost, regions, weight)
+				IS DISTINCT FROM ($2::int4multirange, $3::int4, $4::int4, $5::float8)`,
+				v.Id, toRanges(v.DelivHours), v.Cost, v.Regions, v.Weight)
+		}
+		results := tx.SendBatch(ctx, batch)
+		for _, v := range updates {
+			var tag pgconn.CommandTag
+			tag, err = results.Exec()
+			if err != nil {
+				results.Close()
+				return err
+			}
+			if tag.RowsAffected() == 0 {
+				res.Skipped = append(res.Skipped, v.Id)
+				continue
+			}
+			res.Updated = append(res.Updated, v.Id)
+		}
+		if err = results.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (r *Queries) SetCompliteOrders(ctx context.Context, c, o int64, str string) error {
+// TransitionOrders applies the transitions in one transaction and returns the
+// updated orders. It fails with ErrConflict if any order no longer has the
+// status the transition starts from.
+func (r *Queries) TransitionOrders(ctx context.Context, ts []domain.OrderTransition) (res []domain.Order, err error) {
 	tx, err := r.pool.Begin(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	defer func() {
@@ -129,33 +287,99 @@ func (r *Queries) SetCompliteOrders(ctx context.Context, c, o int64, str string)
 		err = tx.Commit(ctx)
 	}()
 
-	stmt, err := tx.Prepare(ctx, "prod", `INSERT INTO complete_orders (courier_id, order_id,  completed_time) VALUES ($1, $2, $3)`)
-	if err != nil {
-		return err
+	for _, t := range ts {
+		var o domain.Order
+		o, err = applyTransition(ctx, tx, t)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, o)
+	}
+	return res, nil
+}
+
+// applyTransition updates the status of one order inside tx. Orders going
+// back to created or cancelled leave their delivery group; groups left empty
+// are dropped.
+func applyTransition(ctx context.Context, tx pgx.Tx, t domain.OrderTransition) (domain.Order, error) {
+	var err error
+	switch t.To {
+	case domain.OrderCreated, domain.OrderCancelled:
+		err = releaseOrder(ctx, tx, t.OrderID)
+	case domain.OrderCompleted:
+		if t.CourierID == nil || t.CompletedTime == nil {
+			return domain.Order{}, fmt.Errorf("order %d: completion needs a courier and a time", t.OrderID)
+		}
+		_, err = tx.Exec(ctx, "INSERT INTO complete_orders (courier_id, order_id, completed_time) VALUES ($1, $2, $3)",
+			*t.CourierID, t.OrderID, *t.CompletedTime)
+		err = wrapErr(err)
 	}
-	now := time.Now()
-	t, err := time.Parse("15:04", str)
-	year, month, _ := now.Date()
-	now = time.Date(year, month, 1, t.Hour(), t.Minute(), 0, 0, time.UTC)
 	if err != nil {
-		return err
+		return domain.Order{}, err
 	}
-	_, err = tx.Exec(ctx, stmt.SQL, c, o, now)
 
+	var o domain.Order
+	err = scanOrder(tx.QueryRow(ctx, `UPDATE orders SET status = $3::order_status,
+		completed_time = COALESCE($4, completed_time)
+	WHERE id = $1 AND status = $2::order_status
+	RETURNING `+orderColumns, t.OrderID, string(t.From), string(t.To), t.CompletedTime), &o)
 	if err != nil {
-		return err
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.Order{}, fmt.Errorf("order %d is no longer %s: %w", t.OrderID, t.From, domain.ErrConflict)
+		}
+		return domain.Order{}, err
 	}
+	return o, recordStatus(ctx, tx, t)
+}
 
-	stmtStatus, err := tx.Prepare(ctx, "prod1", `UPDATE orders SET completed_time = ($1) where id = ($2)`)
-
+func releaseOrder(ctx context.Context, tx pgx.Tx, orderID int64) error {
+	var groupID int64
+	err := tx.QueryRow(ctx, "DELETE FROM group_orders WHERE order_id = $1 RETURNING group_id", orderID).Scan(&groupID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec(ctx, stmtStatus.SQL, now, o)
+	_, err = tx.Exec(ctx, `DELETE FROM delivery_groups g
+	WHERE g.id = $1 AND NOT EXISTS (SELECT 1 FROM group_orders go WHERE go.group_id = g.id)`, groupID)
+	return err
+}
+
+func recordStatus(ctx context.Context, tx pgx.Tx, t domain.OrderTransition) error {
+	var from *string
+	if t.From != "" {
+		s := string(t.From)
+		from = &s
+	}
+	var requestID *string
+	if id := logging.RequestID(ctx); id != "" {
+		requestID = &id
+	}
+	_, err := tx.Exec(ctx, `INSERT INTO order_status_history (order_id, from_status, to_status, actor, courier_id, request_id)
+	VALUES ($1, $2::order_status, $3::order_status, $4, $5, $6)`,
+		t.OrderID, from, string(t.To), t.Actor, t.CourierID, requestID)
+	return err
+}
 
+func (r *Queries) GetOrderHistory(ctx context.Context, id int64) ([]domain.OrderStatusChange, error) {
+	query := `SELECT from_status::text, to_status::text, actor, courier_id, COALESCE(request_id, ''), changed_at
+	FROM order_status_history WHERE order_id = $1 ORDER BY id`
+	rows, err := r.pool.Query(ctx, query, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return err
+	var changes []domain.OrderStatusChange
+
+	for rows.Next() {
+		var c domain.OrderStatusChange
+		err = rows.Scan(&c.From, &c.To, &c.Actor, &c.CourierID, &c.RequestID, &c.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
 }
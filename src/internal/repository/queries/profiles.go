@@ -0,0 +1,29 @@
+package queries
+
+import (
+	"context"
+	"yaa/internal/domain"
+)
+
+func (r *Queries) GetCourierTypeProfiles(ctx context.Context) (map[string]domain.CourierTypeProfile, error) {
+	query := `SELECT cour_type, max_weight, max_orders, max_regions, first_order_minutes, next_order_minutes,
+	earnings_coef, rating_coef FROM courier_type_profiles`
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := make(map[string]domain.CourierTypeProfile)
+
+	for rows.Next() {
+		var p domain.CourierTypeProfile
+		err = rows.Scan(&p.Type, &p.MaxWeight, &p.MaxOrders, &p.MaxRegions, &p.FirstOrderMinutes,
+			&p.NextOrderMinutes, &p.EarningsCoef, &p.RatingCoef)
+		if err != nil {
+			return nil, err
+		}
+		profiles[p.Type] = p
+	}
+	return profiles, rows.Err()
+}
@@ -1,13 +1,35 @@
 package queries
 
 import (
+	"context"
+
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 type Queries struct {
-	pool *pgxpool.Pool
+	pool *tracedPool
 }
 
 func New(pgxPool *pgxpool.Pool) *Queries {
-	return &Queries{pool: pgxPool}
+	return &Queries{pool: &tracedPool{pool: pgxPool}}
+}
+
+// InTx runs fn in a transaction and commits it unless fn fails. Queries made
+// with the context passed to fn run in that transaction, and transactions
+// they begin become savepoints of it.
+func (r *Queries) InTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+
+	return fn(withTx(ctx, tx))
 }
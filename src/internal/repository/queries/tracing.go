@@ -0,0 +1,208 @@
+package queries
+
+import (
+	"context"
+	"strings"
+	"yaa/pkg/tracing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedPool wraps the pool so that every statement runs inside its own span.
+// Statements made with a context from withTx run in that transaction instead.
+type tracedPool struct {
+	pool *pgxpool.Pool
+}
+
+type txKey struct{}
+
+// withTx makes the queries made with the returned context run in tx.
+func withTx(ctx context.Context, tx pgx.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+func txFrom(ctx context.Context) pgx.Tx {
+	tx, _ := ctx.Value(txKey{}).(pgx.Tx)
+	return tx
+}
+
+func (p *tracedPool) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if tx := txFrom(ctx); tx != nil {
+		return tx.Exec(ctx, sql, args...)
+	}
+	ctx, span := startQuery(ctx, sql)
+	tag, err := p.pool.Exec(ctx, sql, args...)
+	tracing.End(span, err)
+	return tag, err
+}
+
+func (p *tracedPool) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if tx := txFrom(ctx); tx != nil {
+		return tx.Query(ctx, sql, args...)
+	}
+	ctx, span := startQuery(ctx, sql)
+	rows, err := p.pool.Query(ctx, sql, args...)
+	if err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+func (p *tracedPool) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if tx := txFrom(ctx); tx != nil {
+		return tx.QueryRow(ctx, sql, args...)
+	}
+	ctx, span := startQuery(ctx, sql)
+	return &tracedRow{row: p.pool.QueryRow(ctx, sql, args...), span: span}
+}
+
+// Begin starts a transaction, or a savepoint when ctx already runs in one.
+func (p *tracedPool) Begin(ctx context.Context) (pgx.Tx, error) {
+	var (
+		tx  pgx.Tx
+		err error
+	)
+	if outer := txFrom(ctx); outer != nil {
+		tx, err = outer.Begin(ctx)
+	} else {
+		tx, err = p.pool.Begin(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tracedTx{Tx: tx}, nil
+}
+
+type tracedTx struct {
+	pgx.Tx
+}
+
+func (t *tracedTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, span := startQuery(ctx, sql)
+	tag, err := t.Tx.Exec(ctx, sql, args...)
+	tracing.End(span, err)
+	return tag, err
+}
+
+func (t *tracedTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, span := startQuery(ctx, sql)
+	rows, err := t.Tx.Query(ctx, sql, args...)
+	if err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+func (t *tracedTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	ctx, span := startQuery(ctx, sql)
+	return &tracedRow{row: t.Tx.QueryRow(ctx, sql, args...), span: span}
+}
+
+func (t *tracedTx) CopyFrom(ctx context.Context, table pgx.Identifier, columns []string, src pgx.CopyFromSource) (int64, error) {
+	ctx, span := tracing.Start(ctx, "db COPY",
+		semconv.DBSystemPostgreSQL,
+		semconv.DBOperation("COPY"),
+		semconv.DBSQLTable(table.Sanitize()),
+	)
+	n, err := t.Tx.CopyFrom(ctx, table, columns, src)
+	span.SetAttributes(attribute.Int64("db.rows", n))
+	tracing.End(span, err)
+	return n, err
+}
+
+func (t *tracedTx) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	ctx, span := tracing.Start(ctx, "db BATCH",
+		semconv.DBSystemPostgreSQL,
+		semconv.DBOperation("BATCH"),
+		attribute.Int("db.statements", b.Len()),
+	)
+	return &tracedBatch{BatchResults: t.Tx.SendBatch(ctx, b), span: span}
+}
+
+// tracedBatch ends the batch span once the results are closed, recording the
+// first statement that failed.
+type tracedBatch struct {
+	pgx.BatchResults
+	span trace.Span
+	err  error
+}
+
+func (b *tracedBatch) Exec() (pgconn.CommandTag, error) {
+	tag, err := b.BatchResults.Exec()
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+	return tag, err
+}
+
+func (b *tracedBatch) Close() error {
+	err := b.BatchResults.Close()
+	if b.err != nil {
+		tracing.End(b.span, b.err)
+	} else {
+		tracing.End(b.span, err)
+	}
+	return err
+}
+
+// tracedRows ends the query span once the result set is closed.
+type tracedRows struct {
+	pgx.Rows
+	span  trace.Span
+	ended bool
+}
+
+func (r *tracedRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.end()
+	return false
+}
+
+func (r *tracedRows) Close() {
+	r.Rows.Close()
+	r.end()
+}
+
+func (r *tracedRows) end() {
+	if r.ended {
+		return
+	}
+	r.ended = true
+	tracing.End(r.span, r.Rows.Err())
+}
+
+type tracedRow struct {
+	row  pgx.Row
+	span trace.Span
+}
+
+func (r *tracedRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	if err == pgx.ErrNoRows {
+		r.span.End()
+		return err
+	}
+	tracing.End(r.span, err)
+	return err
+}
+
+func startQuery(ctx context.Context, sql string) (context.Context, trace.Span) {
+	op := sql
+	if fields := strings.Fields(sql); len(fields) > 0 {
+		op = strings.ToUpper(fields[0])
+	}
+	return tracing.Start(ctx, "db "+op,
+		semconv.DBSystemPostgreSQL,
+		semconv.DBOperation(op),
+		semconv.DBStatement(sql),
+	)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 	"yaa/internal/domain"
+	"yaa/internal/logging"
 	"yaa/internal/repository/queries"
 
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -11,27 +12,69 @@ import (
 )
 
 type Repository interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
 	GetCourier(ctx context.Context, id int64) (*domain.Courier, error)
-	GetCouriers(ctx context.Context, o, l int) ([]domain.Courier, error)
-	AddCouriers(ctx context.Context, couriers domain.CourierSl) error
+	GetCouriers(ctx context.Context, f domain.CourierFilter, p domain.PageRequest) ([]domain.Courier, error)
+	CountCouriers(ctx context.Context, f domain.CourierFilter) (int64, error)
+	AddCouriers(ctx context.Context, couriers domain.CourierSl, mode domain.ImportMode) (domain.ImportResult, error)
+	AddCouriersFrom(ctx context.Context, feed domain.CourierFeed, mode domain.ImportMode) (domain.ImportResult, error)
+	UpdateCourier(ctx context.Context, id int64, match domain.VersionMatch, patch domain.CourierPatch) (*domain.Courier, error)
+	DeactivateCourier(ctx context.Context, id int64, match domain.VersionMatch) error
 	GetOrder(ctx context.Context, id int64) (*domain.Order, error)
-	GetOrders(ctx context.Context, o, l int) (domain.OrderSl, error)
-	AddOrders(ctx context.Context, orders domain.OrderSl) error
-	ExistOrder(ctx context.Context, c, o int64) (bool, error)
-	SetCompliteOrders(ctx context.Context, c, o int64, str string) error
-	CouriersMeta(ctx context.Context, start, end time.Time, courID int64) (error, domain.Rating)
+	GetOrders(ctx context.Context, f domain.OrderFilter, p domain.PageRequest) ([]domain.Order, error)
+	CountOrders(ctx context.Context, f domain.OrderFilter) (int64, error)
+	AddOrders(ctx context.Context, orders domain.OrderSl, mode domain.ImportMode) (domain.ImportResult, error)
+	AddOrdersFrom(ctx context.Context, feed domain.OrderFeed, mode domain.ImportMode) (domain.ImportResult, error)
+	GetOrdersByID(ctx context.Context, ids []int64) ([]domain.Order, error)
+	TransitionOrders(ctx context.Context, ts []domain.OrderTransition) ([]domain.Order, error)
+	GetOrderHistory(ctx context.Context, id int64) ([]domain.OrderStatusChange, error)
+	CourierStats(ctx context.Context, start, end time.Time, courID int64) (domain.CourierStats, error)
+	GetCourierTypeProfiles(ctx context.Context) (map[string]domain.CourierTypeProfile, error)
+	GetAllCouriers(ctx context.Context) ([]domain.Courier, error)
+	GetUnassignedOrders(ctx context.Context, date time.Time) ([]domain.Order, error)
+	WithAssignmentLock(ctx context.Context, fn func(ctx context.Context) error) error
+	GetCouriersBusyUntil(ctx context.Context, date time.Time) (map[int64]time.Time, error)
+	AddAssignments(ctx context.Context, date time.Time, assignments []domain.CourierAssignment) error
+	ReassignOrder(ctx context.Context, t domain.OrderTransition, date time.Time, a domain.CourierAssignment) (domain.Order, error)
+	GetAssignments(ctx context.Context, date time.Time, courID int64) ([]domain.CourierAssignment, error)
+	CreateImportJob(ctx context.Context, format string, mode domain.ImportMode, payload []byte) (domain.ImportJob, error)
+	GetImportJob(ctx context.Context, id int64) (domain.ImportJob, error)
+	ClaimImportJob(ctx context.Context, lease time.Duration) (*domain.ImportJob, []byte, error)
+	SaveImportProgress(ctx context.Context, j domain.ImportJob) error
+	RenewImportLease(ctx context.Context, id int64, attempt int) error
+	FinishImportJob(ctx context.Context, id int64, attempt int, status domain.ImportJobStatus, msg string) error
+	RequeueImportJob(ctx context.Context, id int64, attempt int) error
 }
 
 type repo struct {
 	*queries.Queries
-	logger logrus.FieldLogger
-	pool   pgxpool.Pool
+	logger  logrus.FieldLogger
+	pool    *pgxpool.Pool
+	tariffs map[string]domain.Tariff
 }
 
-func NewRepository(pgxPool *pgxpool.Pool, logger logrus.FieldLogger) Repository {
+func NewRepository(pgxPool *pgxpool.Pool, logger logrus.FieldLogger, tariffs map[string]domain.Tariff) Repository {
 	return &repo{
 		Queries: queries.New(pgxPool),
 		logger:  logger,
-		pool:    *pgxPool,
+		pool:    pgxPool,
+		tariffs: tariffs,
 	}
 }
+
+func (r *repo) GetCourierTypeProfiles(ctx context.Context) (map[string]domain.CourierTypeProfile, error) {
+	profiles, err := r.Queries.GetCourierTypeProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for t, tariff := range r.tariffs {
+		p, ok := profiles[t]
+		if !ok {
+			continue
+		}
+		p.EarningsCoef, p.RatingCoef = tariff.EarningsCoef, tariff.RatingCoef
+		profiles[t] = p
+		logging.FromContext(ctx, r.logger).Debugf("courier type %s tariff overridden from config", t)
+	}
+	return profiles, nil
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+	"yaa/internal/domain"
+	"yaa/internal/logging"
+	"yaa/internal/metrics"
+	"yaa/pkg/tracing"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const minutesPerDay = 24 * 60
+
+type assignmentsRepo interface {
+	GetAllCouriers(ctx context.Context) ([]domain.Courier, error)
+	GetUnassignedOrders(ctx context.Context, date time.Time) ([]domain.Order, error)
+	WithAssignmentLock(ctx context.Context, fn func(ctx context.Context) error) error
+	GetCouriersBusyUntil(ctx context.Context, date time.Time) (map[int64]time.Time, error)
+	AddAssignments(ctx context.Context, date time.Time, assignments []domain.CourierAssignment) error
+	GetCourierTypeProfiles(ctx context.Context) (map[string]domain.CourierTypeProfile, error)
+}
+
+type AssignmentService struct {
+	repo   assignmentsRepo
+	logger logrus.FieldLogger
+	now    func() time.Time
+}
+
+func NewAssignmentService(repo assignmentsRepo, logger logrus.FieldLogger) *AssignmentService {
+	return &AssignmentService{
+		repo:   repo,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+type pendingOrder struct {
+	order   domain.Order
+	windows []domain.TimeInterval
+}
+
+func (c *AssignmentService) AssignOrders(ctx context.Context, date time.Time) (_ domain.AssignmentSl, err error) {
+	ctx, span := tracing.Start(ctx, "AssignmentService.AssignOrders", attribute.String("date", date.Format("2006-01-02")))
+	defer func() { tracing.End(span, err) }()
+
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	res := domain.AssignmentSl{Date: date.Format("2006-01-02")}
+
+	var assigned int
+	err = c.repo.WithAssignmentLock(ctx, func(ctx context.Context) error {
+		res.Couriers, assigned, err = c.assign(ctx, date)
+		return err
+	})
+	if err != nil {
+		return domain.AssignmentSl{Date: res.Date}, err
+	}
+	if assigned > 0 {
+		metrics.OrdersAssigned.Add(float64(assigned))
+		logging.FromContext(ctx, c.logger).WithField("orders", assigned).Info("orders assigned")
+	}
+	return res, nil
+}
+
+// assign plans the trips of every courier for date and stores them. It runs
+// under the assignment lock and returns the trips with the number of orders
+// they cover.
+func (c *AssignmentService) assign(ctx context.Context, date time.Time) ([]domain.CourierAssignment, int, error) {
+	couriers, err := c.repo.GetAllCouriers(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	orders, err := c.repo.GetUnassignedOrders(ctx, date)
+	if err != nil {
+		return nil, 0, err
+	}
+	busy, err := c.repo.GetCouriersBusyUntil(ctx, date)
+	if err != nil {
+		return nil, 0, err
+	}
+	profiles, err := c.repo.GetCourierTypeProfiles(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	logger := logging.FromContext(ctx, c.logger)
+
+	pending := make([]pendingOrder, 0, len(orders))
+	for _, o := range orders {
+		if len(o.DelivHours) == 0 {
+			logger.Warnf("order %d has no delivery hours, skipping", o.Id)
+			continue
+		}
+		pending = append(pending, pendingOrder{order: o, windows: sortIntervals(o.DelivHours)})
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		if pending[i].windows[0].Start != pending[j].windows[0].Start {
+			return pending[i].windows[0].Start < pending[j].windows[0].Start
+		}
+		return pending[i].order.Id < pending[j].order.Id
+	})
+
+	var res []domain.CourierAssignment
+	assigned := make(map[int64]bool)
+	now := c.now()
+	for _, courier := range couriers {
+		profile, ok := profiles[courier.Type]
+		if !ok {
+			logger.Warnf("courier %d has unknown type %q, skipping", courier.Id, courier.Type)
+			continue
+		}
+
+		cursor := planFrom(date, now, busy[courier.Id])
+
+		var groups []domain.DeliveryGroup
+		for _, work := range sortIntervals(courier.WorkHours) {
+			t := cursor
+			if t < work.Start {
+				t = work.Start
+			}
+			for {
+				group, start, finish := buildGroup(courier, profile, work, t, pending, assigned)
+				if len(group.Orders) == 0 {
+					break
+				}
+				group.StartTime = date.Add(time.Duration(start) * time.Minute)
+				group.FinishTime = date.Add(time.Duration(finish) * time.Minute)
+				groups = append(groups, group)
+				t = finish
+			}
+		}
+		if len(groups) > 0 {
+			res = append(res, domain.CourierAssignment{IdCourier: courier.Id, Groups: groups})
+		}
+	}
+
+	if len(res) == 0 {
+		return nil, 0, nil
+	}
+	if err = c.repo.AddAssignments(ctx, date, res); err != nil {
+		return nil, 0, err
+	}
+	return res, len(assigned), nil
+}
+
+// planFrom returns the minute of date from which the next trip of a courier
+// busy until busyUntil can start: after its trips of the day and, when date
+// is today, not before now.
+func planFrom(date, now, busyUntil time.Time) int {
+	cursor := 0
+	if now.After(date) && now.Before(date.AddDate(0, 0, 1)) {
+		cursor = int(math.Ceil(now.Sub(date).Minutes()))
+	}
+	if !busyUntil.IsZero() {
+		if m := int(math.Ceil(busyUntil.Sub(date).Minutes())); m > cursor {
+			cursor = m
+		}
+	}
+	return cursor
+}
+
+// buildGroup greedily packs pending orders into one trip starting no earlier
+// than t. The first order may delay the start until its delivery window
+// opens; each next order must be deliverable right after the previous one.
+func buildGroup(courier domain.Courier, profile domain.CourierTypeProfile, work domain.TimeInterval, t int,
+	pending []pendingOrder, assigned map[int64]bool) (domain.DeliveryGroup, int, int) {
+	var (
+		group   domain.DeliveryGroup
+		weight  float32
+		regions = make(map[int32]bool)
+		last    int
+	)
+
+	for _, p := range pending {
+		if len(group.Orders) == profile.MaxOrders {
+			break
+		}
+		o := p.order
+		if assigned[o.Id] || !containsRegion(courier.Regions, o.Regions) || weight+o.Weight > profile.MaxWeight {
+			continue
+		}
+		if !regions[o.Regions] && len(regions) == profile.MaxRegions {
+			continue
+		}
+
+		var at int
+		if len(group.Orders) == 0 {
+			start, ok := earliestStart(p.windows, work, t, profile.FirstOrderMinutes)
+			if !ok {
+				continue
+			}
+			t, at = start, start+profile.FirstOrderMinutes
+		} else {
+			at = last + profile.NextOrderMinutes
+			if _, end := work.Bounds(); at > end || !inWindows(p.windows, at) {
+				continue
+			}
+		}
+
+		group.Orders = append(group.Orders, o.Id)
+		group.Cost += o.Cost
+		weight += o.Weight
+		regions[o.Regions] = true
+		assigned[o.Id] = true
+		last = at
+	}
+	return group, t, last
+}
+
+// earliestStart finds the first start not before t at which an order taking
+// d minutes lands inside both one of its delivery windows and the work
+// window. Windows are compared on the axis of the work window, which runs
+// past 24:00 when the shift crosses midnight, so a window after midnight is
+// also tried a day later and one crossing midnight a day earlier.
+func earliestStart(windows []domain.TimeInterval, work domain.TimeInterval, t, d int) (int, bool) {
+	_, workEnd := work.Bounds()
+	best, found := 0, false
+	for _, w := range windows {
+		lo, hi := w.Bounds()
+		for _, shift := range []int{-minutesPerDay, 0, minutesPerDay} {
+			start := t
+			if start+d < lo+shift {
+				start = lo + shift - d
+			}
+			at := start + d
+			if at <= hi+shift && at <= workEnd && (!found || start < best) {
+				best, found = start, true
+			}
+		}
+	}
+	return best, found
+}
+
+func inWindows(windows []domain.TimeInterval, at int) bool {
+	for _, w := range windows {
+		if w.Contains(at) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsRegion(regions []int32, region int32) bool {
+	for _, r := range regions {
+		if r == region {
+			return true
+		}
+	}
+	return false
+}
+
+func sortIntervals(src []domain.TimeInterval) []domain.TimeInterval {
+	res := append([]domain.TimeInterval(nil), src...)
+	sort.Slice(res, func(i, j int) bool { return res[i].Start < res[j].Start })
+	return res
+}
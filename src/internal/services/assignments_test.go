@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+	"yaa/internal/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+var testProfiles = map[string]domain.CourierTypeProfile{
+	"FOOT": {Type: "FOOT", MaxWeight: 10, MaxOrders: 2, MaxRegions: 1, FirstOrderMinutes: 25, NextOrderMinutes: 10},
+	"BIKE": {Type: "BIKE", MaxWeight: 20, MaxOrders: 4, MaxRegions: 2, FirstOrderMinutes: 12, NextOrderMinutes: 8},
+}
+
+type fakeAssignmentsRepo struct {
+	couriers []domain.Courier
+	orders   []domain.Order
+	busy     map[int64]time.Time
+	saved    []domain.CourierAssignment
+	locked   bool
+	unlocked bool
+}
+
+func (f *fakeAssignmentsRepo) GetAllCouriers(ctx context.Context) ([]domain.Courier, error) {
+	return f.couriers, nil
+}
+
+func (f *fakeAssignmentsRepo) GetUnassignedOrders(ctx context.Context, date time.Time) ([]domain.Order, error) {
+	return f.orders, nil
+}
+
+func (f *fakeAssignmentsRepo) GetCouriersBusyUntil(ctx context.Context, date time.Time) (map[int64]time.Time, error) {
+	return f.busy, nil
+}
+
+func (f *fakeAssignmentsRepo) AddAssignments(ctx context.Context, date time.Time, assignments []domain.CourierAssignment) error {
+	f.saved = assignments
+	return nil
+}
+
+func (f *fakeAssignmentsRepo) GetCourierTypeProfiles(ctx context.Context) (map[string]domain.CourierTypeProfile, error) {
+	return testProfiles, nil
+}
+
+func (f *fakeAssignmentsRepo) WithAssignmentLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	f.locked = true
+	defer func() { f.unlocked = true }()
+	return fn(ctx)
+}
+
+func interval(t *testing.T, s string) domain.TimeInterval {
+	t.Helper()
+	iv, err := domain.ParseTimeInterval(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return iv
+}
+
+func TestAssignOrders(t *testing.T) {
+	day := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	at := func(clock string) time.Time {
+		c, _ := time.Parse("15:04", clock)
+		return day.Add(time.Duration(c.Hour())*time.Hour + time.Duration(c.Minute())*time.Minute)
+	}
+	order := func(id int64, weight float32, region int32, hours string) domain.Order {
+		return domain.Order{Id: id, Weight: weight, Regions: region, Cost: 100,
+			DelivHours: []domain.TimeInterval{interval(t, hours)}}
+	}
+	courier := func(typ string, regions []int32, hours string) domain.Courier {
+		return domain.Courier{Id: 1, Type: typ, Regions: regions, WorkHours: []domain.TimeInterval{interval(t, hours)}}
+	}
+
+	type group struct {
+		orders        []int64
+		start, finish string
+	}
+	tests := []struct {
+		name    string
+		courier domain.Courier
+		orders  []domain.Order
+		busy    string
+		now     string
+		want    []group
+	}{
+		{
+			name:    "orders sharing a window go in one trip",
+			courier: courier("BIKE", []int32{1}, "09:00-18:00"),
+			orders:  []domain.Order{order(1, 5, 1, "10:00-12:00"), order(2, 5, 1, "10:00-12:00")},
+			want:    []group{{[]int64{1, 2}, "09:48", "10:08"}},
+		},
+		{
+			name:    "weight over capacity starts a new trip",
+			courier: courier("FOOT", []int32{1}, "09:00-18:00"),
+			orders:  []domain.Order{order(1, 6, 1, "10:00-12:00"), order(2, 6, 1, "10:00-12:00")},
+			want:    []group{{[]int64{1}, "09:35", "10:00"}, {[]int64{2}, "10:00", "10:25"}},
+		},
+		{
+			name:    "order count over capacity starts a new trip",
+			courier: courier("FOOT", []int32{1}, "09:00-18:00"),
+			orders: []domain.Order{order(1, 1, 1, "10:00-12:00"), order(2, 1, 1, "10:00-12:00"),
+				order(3, 1, 1, "10:00-12:00")},
+			want: []group{{[]int64{1, 2}, "09:35", "10:10"}, {[]int64{3}, "10:10", "10:35"}},
+		},
+		{
+			name:    "orders outside the courier's regions are left",
+			courier: courier("BIKE", []int32{1}, "09:00-18:00"),
+			orders:  []domain.Order{order(1, 1, 2, "10:00-12:00"), order(2, 1, 1, "10:00-12:00")},
+			want:    []group{{[]int64{2}, "09:48", "10:00"}},
+		},
+		{
+			name:    "a trip covers at most max_regions regions",
+			courier: courier("BIKE", []int32{1, 2, 3}, "09:00-18:00"),
+			orders: []domain.Order{order(1, 1, 1, "10:00-12:00"), order(2, 1, 2, "10:00-12:00"),
+				order(3, 1, 3, "10:00-12:00")},
+			want: []group{{[]int64{1, 2}, "09:48", "10:08"}, {[]int64{3}, "10:08", "10:20"}},
+		},
+		{
+			name:    "windows outside working hours are left",
+			courier: courier("BIKE", []int32{1}, "09:00-18:00"),
+			orders:  []domain.Order{order(1, 1, 1, "20:00-21:00")},
+		},
+		{
+			name:    "the next order must fit its own window",
+			courier: courier("BIKE", []int32{1}, "09:00-18:00"),
+			orders:  []domain.Order{order(1, 1, 1, "10:00-10:05"), order(2, 1, 1, "10:30-11:00")},
+			want:    []group{{[]int64{1}, "09:48", "10:00"}, {[]int64{2}, "10:18", "10:30"}},
+		},
+		{
+			name:    "trips start after earlier groups of the day",
+			courier: courier("BIKE", []int32{1}, "09:00-18:00"),
+			orders:  []domain.Order{order(1, 1, 1, "10:00-12:00")},
+			busy:    "11:00",
+			want:    []group{{[]int64{1}, "11:00", "11:12"}},
+		},
+		{
+			name:    "trips for today start no earlier than now",
+			courier: courier("BIKE", []int32{1}, "09:00-18:00"),
+			orders:  []domain.Order{order(1, 1, 1, "10:00-16:00"), order(2, 1, 1, "10:00-12:00")},
+			now:     "14:59",
+			want:    []group{{[]int64{1}, "14:59", "15:11"}},
+		},
+		{
+			name:    "windows after midnight fit shifts crossing it",
+			courier: courier("BIKE", []int32{1}, "22:00-02:00"),
+			orders:  []domain.Order{order(1, 1, 1, "00:30-01:30"), order(2, 1, 1, "00:35-01:00")},
+			want:    []group{{[]int64{1, 2}, "00:18", "00:38"}},
+		},
+		{
+			name:    "windows crossing midnight fit shifts after it",
+			courier: courier("BIKE", []int32{1}, "00:00-08:00"),
+			orders:  []domain.Order{order(1, 1, 1, "23:30-01:00")},
+			want:    []group{{[]int64{1}, "00:00", "00:12"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeAssignmentsRepo{couriers: []domain.Courier{tt.courier}, orders: tt.orders,
+				busy: map[int64]time.Time{}}
+			if tt.busy != "" {
+				repo.busy[tt.courier.Id] = at(tt.busy)
+			}
+			svc := NewAssignmentService(repo, logrus.New())
+			svc.now = func() time.Time { return day.AddDate(0, 0, 1) }
+			if tt.now != "" {
+				svc.now = func() time.Time { return at(tt.now) }
+			}
+			res, err := svc.AssignOrders(context.Background(), day)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !repo.locked || !repo.unlocked {
+				t.Errorf("lock taken %v, released %v", repo.locked, repo.unlocked)
+			}
+
+			var got []group
+			for _, c := range res.Couriers {
+				for _, g := range c.Groups {
+					got = append(got, group{g.Orders, g.StartTime.Format("15:04"), g.FinishTime.Format("15:04")})
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groups = %v, want %v", got, tt.want)
+			}
+			if len(tt.want) == 0 && repo.saved != nil {
+				t.Errorf("saved %v for an empty run", repo.saved)
+			}
+		})
+	}
+}
@@ -2,17 +2,27 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"time"
 	"yaa/internal/domain"
+	"yaa/internal/logging"
+	"yaa/internal/metrics"
+	"yaa/pkg/tracing"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type couriersRepo interface {
 	GetCourier(ctx context.Context, id int64) (*domain.Courier, error)
-	GetCouriers(ctx context.Context, o, l int) ([]domain.Courier, error)
-	AddCouriers(ctx context.Context, couriers domain.CourierSl) error
-	CouriersMeta(ctx context.Context, start, end time.Time, courID int64) (error, domain.Rating)
+	GetCouriers(ctx context.Context, f domain.CourierFilter, p domain.PageRequest) ([]domain.Courier, error)
+	CountCouriers(ctx context.Context, f domain.CourierFilter) (int64, error)
+	AddCouriersFrom(ctx context.Context, feed domain.CourierFeed, mode domain.ImportMode) (domain.ImportResult, error)
+	CourierStats(ctx context.Context, start, end time.Time, courID int64) (domain.CourierStats, error)
+	GetCourierTypeProfiles(ctx context.Context) (map[string]domain.CourierTypeProfile, error)
+	GetAssignments(ctx context.Context, date time.Time, courID int64) ([]domain.CourierAssignment, error)
+	UpdateCourier(ctx context.Context, id int64, match domain.VersionMatch, patch domain.CourierPatch) (*domain.Courier, error)
+	DeactivateCourier(ctx context.Context, id int64, match domain.VersionMatch) error
 }
 
 type CourierService struct {
@@ -27,7 +37,10 @@ func NewCouriersService(repo couriersRepo, logger logrus.FieldLogger) *CourierSe
 	}
 }
 
-func (c *CourierService) GetCourier(ctx context.Context, courierID int64) (*domain.Courier, error) {
+func (c *CourierService) GetCourier(ctx context.Context, courierID int64) (_ *domain.Courier, err error) {
+	ctx, span := tracing.Start(ctx, "CourierService.GetCourier", attribute.Int64("courier_id", courierID))
+	defer func() { tracing.End(span, err) }()
+
 	courier, err := c.repo.GetCourier(ctx, courierID)
 	if err != nil {
 		return nil, err
@@ -35,31 +48,172 @@ func (c *CourierService) GetCourier(ctx context.Context, courierID int64) (*doma
 	return courier, nil
 }
 
-func (c *CourierService) GetCouriers(ctx context.Context, o, l int) ([]domain.Courier, error) {
-	couriers, err := c.repo.GetCouriers(ctx, o, l)
+func (c *CourierService) GetCouriers(ctx context.Context, f domain.CourierFilter, p domain.PageRequest) (_ domain.CourierPage, err error) {
+	ctx, span := tracing.Start(ctx, "CourierService.GetCouriers", attribute.Int("limit", p.Limit),
+		attribute.Bool("by_cursor", p.ByCursor), attribute.String("sort", p.Sort))
+	defer func() { tracing.End(span, err) }()
 
+	couriers, err := c.repo.GetCouriers(ctx, f, p)
+	if err != nil {
+		return domain.CourierPage{}, err
+	}
+
+	more := len(couriers) > p.Limit
+	if more {
+		couriers = couriers[:p.Limit]
+	}
+	res := domain.CourierPage{Couriers: couriers}
+	if res.Couriers == nil {
+		res.Couriers = []domain.Courier{}
+	}
+	var lastID int64
+	if len(couriers) > 0 {
+		lastID = couriers[len(couriers)-1].Id
+	}
+	res.Pagination = domain.NewPagination(p, lastID, more)
+
+	if p.WithTotal {
+		total, err := c.repo.CountCouriers(ctx, f)
+		if err != nil {
+			return domain.CourierPage{}, err
+		}
+		res.Total = &total
+	}
+	return res, nil
+}
+
+// AddCouriers stores the chunks the feed hands over in one transaction.
+func (c *CourierService) AddCouriers(ctx context.Context, feed domain.CourierFeed, mode domain.ImportMode) (_ domain.ImportResult, err error) {
+	ctx, span := tracing.Start(ctx, "CourierService.AddCouriers", attribute.String("mode", string(mode)))
+	defer func() { tracing.End(span, err) }()
+
+	res, err := c.repo.AddCouriersFrom(ctx, feed, mode)
+	if err != nil {
+		return domain.ImportResult{}, err
+	}
+	span.SetAttributes(attribute.Int("couriers", len(res.Created)+len(res.Updated)+len(res.Skipped)))
+	metrics.CouriersRegistered.Add(float64(len(res.Created)))
+	logging.FromContext(ctx, c.logger).WithFields(logrus.Fields{
+		"created": len(res.Created), "updated": len(res.Updated), "skipped": len(res.Skipped),
+	}).Info("couriers registered")
+	return res, nil
+}
+
+func (c *CourierService) CouriersMeta(ctx context.Context, start, end string, courierID int64) (_ domain.CourierMeta, err error) {
+	ctx, span := tracing.Start(ctx, "CourierService.CouriersMeta", attribute.Int64("courier_id", courierID),
+		attribute.String("start_date", start), attribute.String("end_date", end))
+	defer func() { tracing.End(span, err) }()
+
+	if start == "" || end == "" {
+		return domain.CourierMeta{}, fmt.Errorf("start_date and end_date are required: %w", domain.ErrValidation)
+	}
+	tStart, err := time.Parse("2006-01-02", start)
+	if err != nil {
+		return domain.CourierMeta{}, fmt.Errorf("invalid start_date %q: %w", start, domain.ErrValidation)
+	}
+	tEnd, err := time.Parse("2006-01-02", end)
+	if err != nil {
+		return domain.CourierMeta{}, fmt.Errorf("invalid end_date %q: %w", end, domain.ErrValidation)
+	}
+	if !tStart.Before(tEnd) {
+		return domain.CourierMeta{}, fmt.Errorf("start_date must be before end_date: %w", domain.ErrValidation)
+	}
+
+	courier, err := c.repo.GetCourier(ctx, courierID)
+	if err != nil {
+		return domain.CourierMeta{}, err
+	}
+	profiles, err := c.repo.GetCourierTypeProfiles(ctx)
+	if err != nil {
+		return domain.CourierMeta{}, err
+	}
+	stats, err := c.repo.CourierStats(ctx, tStart, tEnd, courierID)
+	if err != nil {
+		return domain.CourierMeta{}, err
+	}
+
+	span.SetAttributes(attribute.Int64("completed_orders", stats.Completed))
+
+	meta := domain.CourierMeta{
+		Courier:            *courier,
+		CompletedOrders:    stats.Completed,
+		AvgDeliveryMinutes: stats.AvgDeliveryMinutes,
+		RegionBreakdown:    []domain.RegionStats{},
+	}
+
+	// Each order earns and rates with the profile of the type the courier
+	// had when completing it.
+	var earnings, rating float32
+	hours := tEnd.Sub(tStart).Hours()
+	for _, row := range stats.Breakdown {
+		profile, ok := profiles[row.Type]
+		if !ok {
+			return domain.CourierMeta{}, fmt.Errorf("no profile for courier type %q", row.Type)
+		}
+		n := len(meta.RegionBreakdown)
+		if n == 0 || meta.RegionBreakdown[n-1].Region != row.Region {
+			meta.RegionBreakdown = append(meta.RegionBreakdown, domain.RegionStats{Region: row.Region})
+			n++
+		}
+		rs := &meta.RegionBreakdown[n-1]
+		rs.Completed += row.Completed
+		rs.TotalCost += row.TotalCost
+		rs.Earnings += profile.Earnings(row.TotalCost)
+
+		earnings += profile.Earnings(row.TotalCost)
+		rating += profile.Rating(row.Completed, hours)
+	}
+	if stats.Completed > 0 {
+		meta.Earnings, meta.Rating = &earnings, &rating
+	}
+	return meta, nil
+}
+
+// UpdateCourier applies patch to the courier if its version matches.
+func (c *CourierService) UpdateCourier(ctx context.Context, courierID int64, match domain.VersionMatch, patch domain.CourierPatch) (_ *domain.Courier, err error) {
+	ctx, span := tracing.Start(ctx, "CourierService.UpdateCourier", attribute.Int64("courier_id", courierID),
+		attribute.Int64Slice("versions", match.Versions))
+	defer func() { tracing.End(span, err) }()
+
+	courier, err := c.repo.UpdateCourier(ctx, courierID, match, patch)
 	if err != nil {
 		return nil, err
 	}
-	return couriers, nil
+	logger := logging.FromContext(ctx, c.logger)
+	if patch.Type != nil {
+		logger.Infof("courier %d type set to %s", courierID, courier.Type)
+	}
+	logger.WithField("version", courier.Version).Info("courier updated")
+	return courier, nil
 }
 
-func (c *CourierService) AddCouriers(ctx context.Context, couriers domain.CourierSl) error {
-	err := c.repo.AddCouriers(ctx, couriers)
+// DeactivateCourier stops assigning orders to the courier and returns the
+// orders it has not picked up to the pool; its history stays available for
+// statistics. A courier still delivering an order cannot be deactivated.
+func (c *CourierService) DeactivateCourier(ctx context.Context, courierID int64, match domain.VersionMatch) (err error) {
+	ctx, span := tracing.Start(ctx, "CourierService.DeactivateCourier", attribute.Int64("courier_id", courierID),
+		attribute.Int64Slice("versions", match.Versions))
+	defer func() { tracing.End(span, err) }()
 
+	err = c.repo.DeactivateCourier(ctx, courierID, match)
 	if err != nil {
 		return err
 	}
+	logging.FromContext(ctx, c.logger).Info("courier deactivated")
 	return nil
 }
 
-func (c *CourierService) CouriersMeta(ctx context.Context, start, end string, cour_id int64) (error, domain.Rating) {
+func (c *CourierService) GetAssignments(ctx context.Context, date time.Time, courierID int64) (_ domain.AssignmentSl, err error) {
+	ctx, span := tracing.Start(ctx, "CourierService.GetAssignments", attribute.Int64("courier_id", courierID))
+	defer func() { tracing.End(span, err) }()
 
-	tStart, err := time.Parse("2006-01-02", start)
-	tEnd, err := time.Parse("2006-01-02", end)
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	res := domain.AssignmentSl{Date: date.Format("2006-01-02")}
 
-	nowStart := time.Date(tStart.Year(), tStart.Month(), tStart.Day(), 0, 0, 0, 0, time.UTC)
-	nowEnd := time.Date(tEnd.Year(), tEnd.Month(), tEnd.Day(), 0, 0, 0, 0, time.UTC)
-	err, result := c.repo.CouriersMeta(ctx, nowStart, nowEnd, cour_id)
-	return err, result
+	assignments, err := c.repo.GetAssignments(ctx, date, courierID)
+	if err != nil {
+		return res, err
+	}
+	res.Couriers = assignments
+	return res, nil
 }
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"yaa/internal/domain"
+	"yaa/internal/validation"
+)
+
+// maxLineBytes bounds a single NDJSON line.
+const maxLineBytes = 1 << 20
+
+// importRow is one order read from an import file, or the reason it could not
+// be read.
+type importRow struct {
+	row   int
+	order domain.Order
+	field string
+	err   error
+}
+
+// parseOrderFile splits an import file into rows. Rows that are malformed on
+// their own carry an error and leave the rest of the file usable; an error is
+// returned only when the file as a whole cannot be read.
+func parseOrderFile(format string, payload []byte) ([]importRow, error) {
+	switch format {
+	case domain.ImportJSON:
+		return parseJSONOrders(payload)
+	case domain.ImportNDJSON:
+		return parseNDJSONOrders(payload)
+	case domain.ImportCSV:
+		return parseCSVOrders(payload)
+	}
+	return nil, fmt.Errorf("unsupported import format %q", format)
+}
+
+// parseJSONOrders reads a body shaped like POST /orders, numbering rows by
+// their position in the orders array.
+func parseJSONOrders(payload []byte) ([]importRow, error) {
+	var rows []importRow
+	err := validation.DecodeItems(bytes.NewReader(payload), "orders", func(dec *json.Decoder) error {
+		row := importRow{row: len(rows) + 1}
+		err := dec.Decode(&row.order)
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+		row.err = err
+		rows = append(rows, row)
+		return nil
+	})
+	return rows, err
+}
+
+// parseNDJSONOrders reads one order object per line; blank lines are skipped.
+func parseNDJSONOrders(payload []byte) ([]importRow, error) {
+	var rows []importRow
+	sc := bufio.NewScanner(bytes.NewReader(payload))
+	sc.Buffer(nil, maxLineBytes)
+	for line := 1; sc.Scan(); line++ {
+		text := bytes.TrimSpace(sc.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		row := importRow{row: line}
+		row.err = validation.Decode(bytes.NewReader(text), &row.order)
+		rows = append(rows, row)
+	}
+	return rows, sc.Err()
+}
+
+// csvColumns are the columns a CSV import must have, in any order.
+// delivery_hours holds intervals separated by semicolons.
+var csvColumns = []string{"id", "delivery_hours", "cost", "regions", "weight"}
+
+// parseCSVOrders reads a CSV file with a header row, numbering rows by line.
+func parseCSVOrders(payload []byte) ([]importRow, error) {
+	r := csv.NewReader(bytes.NewReader(payload))
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cols := make(map[string]int, len(header))
+	for i, h := range header {
+		name := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if !isCSVColumn(name) {
+			return nil, fmt.Errorf("csv: unknown column %q", h)
+		}
+		if _, ok := cols[name]; ok {
+			return nil, fmt.Errorf("csv: duplicate column %q", name)
+		}
+		cols[name] = i
+	}
+	for _, name := range csvColumns {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("csv: missing column %q", name)
+		}
+	}
+
+	var rows []importRow
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) && errors.Is(perr.Err, csv.ErrFieldCount) {
+			rows = append(rows, importRow{row: perr.StartLine, err: perr.Err})
+			continue
+		}
+		if err != nil {
+			return rows, err
+		}
+		line, _ := r.FieldPos(0)
+		row := importRow{row: line}
+		row.order, row.field, row.err = csvOrder(rec, cols)
+		rows = append(rows, row)
+	}
+}
+
+func isCSVColumn(name string) bool {
+	for _, c := range csvColumns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// csvOrder converts a record, returning the first field that fails to parse.
+func csvOrder(rec []string, cols map[string]int) (o domain.Order, field string, err error) {
+	value := func(name string) string { return strings.TrimSpace(rec[cols[name]]) }
+
+	if o.Id, err = strconv.ParseInt(value("id"), 10, 64); err != nil {
+		return o, "id", fmt.Errorf("invalid integer %q", value("id"))
+	}
+	for _, s := range strings.Split(value("delivery_hours"), ";") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		iv, err := domain.ParseTimeInterval(s)
+		if err != nil {
+			return o, "delivery_hours", err
+		}
+		o.DelivHours = append(o.DelivHours, iv)
+	}
+	cost, err := strconv.ParseInt(value("cost"), 10, 32)
+	if err != nil {
+		return o, "cost", fmt.Errorf("invalid integer %q", value("cost"))
+	}
+	o.Cost = int32(cost)
+	regions, err := strconv.ParseInt(value("regions"), 10, 32)
+	if err != nil {
+		return o, "regions", fmt.Errorf("invalid integer %q", value("regions"))
+	}
+	o.Regions = int32(regions)
+	weight, err := strconv.ParseFloat(value("weight"), 32)
+	if err != nil {
+		return o, "weight", fmt.Errorf("invalid number %q", value("weight"))
+	}
+	o.Weight = float32(weight)
+	return o, "", nil
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+// parsedRow is the part of an importRow the parser tests compare.
+type parsedRow struct {
+	row   int
+	id    int64
+	field string
+	bad   bool
+}
+
+func summarize(rows []importRow) []parsedRow {
+	res := make([]parsedRow, 0, len(rows))
+	for _, r := range rows {
+		res = append(res, parsedRow{row: r.row, id: r.order.Id, field: r.field, bad: r.err != nil})
+	}
+	return res
+}
+
+func TestParseOrderFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		payload string
+		want    []parsedRow
+		wantErr bool
+	}{
+		{
+			name:    "json rows are array positions",
+			format:  "json",
+			payload: `{"orders":[{"id":1,"weight":1,"regions":1,"cost":10,"delivery_hours":["10:00-12:00"]},{"id":2,"weight":2,"regions":1,"cost":10,"delivery_hours":["10:00-12:00"]}]}`,
+			want:    []parsedRow{{row: 1, id: 1}, {row: 2, id: 2}},
+		},
+		{
+			name:    "json bad items do not stop the file",
+			format:  "json",
+			payload: `{"orders":[{"id":1,"weight":"x"},{"id":2,"colour":"red"},{"id":3,"weight":1}]}`,
+			want:    []parsedRow{{row: 1, id: 1, bad: true}, {row: 2, id: 2, bad: true}, {row: 3, id: 3}},
+		},
+		{
+			name:    "json truncated",
+			format:  "json",
+			payload: `{"orders":[{"id":1},{"id":`,
+			wantErr: true,
+		},
+		{
+			name:    "ndjson rows are lines, blank lines count",
+			format:  "ndjson",
+			payload: "{\"id\":1}\n\n  \n{\"id\":4}\n",
+			want:    []parsedRow{{row: 1, id: 1}, {row: 4, id: 4}},
+		},
+		{
+			name:    "ndjson bad lines do not stop the file",
+			format:  "ndjson",
+			payload: "{\"id\":1}\n{\"id\":\n{\"id\":3,\"x\":1}\n{\"id\":4}",
+			want:    []parsedRow{{row: 1, id: 1}, {row: 2, bad: true}, {row: 3, id: 3, bad: true}, {row: 4, id: 4}},
+		},
+		{
+			name:    "csv rows are lines after the header",
+			format:  "csv",
+			payload: "\ufeffWeight, id,regions,cost,delivery_hours\n1,1,1,10,10:00-12:00;14:00-15:00\n2,2,1,10,10:00-12:00\n",
+			want:    []parsedRow{{row: 2, id: 1}, {row: 3, id: 2}},
+		},
+		{
+			name:    "csv bad rows do not stop the file",
+			format:  "csv",
+			payload: "id,delivery_hours,cost,regions,weight\n1,10:00-12:00,ten,1,1\n2,10:00-12:00,10\n3,25:00-26:00,10,1,1\n4,10:00-12:00,10,1,1\n",
+			want: []parsedRow{{row: 2, id: 1, field: "cost", bad: true}, {row: 3, bad: true},
+				{row: 4, id: 3, field: "delivery_hours", bad: true}, {row: 5, id: 4}},
+		},
+		{
+			name:    "csv quoted field spanning lines",
+			format:  "csv",
+			payload: "id,delivery_hours,cost,regions,weight\n1,\"10:00-12:00;\n14:00-15:00\",10,1,1\n2,10:00-12:00,10,1,1\n",
+			want:    []parsedRow{{row: 2, id: 1}, {row: 4, id: 2}},
+		},
+		{
+			name:    "csv missing column",
+			format:  "csv",
+			payload: "id,delivery_hours,cost,regions\n1,10:00-12:00,10,1\n",
+			wantErr: true,
+		},
+		{
+			name:    "csv unknown column",
+			format:  "csv",
+			payload: "id,delivery_hours,cost,regions,weight,colour\n",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported format",
+			format:  "xml",
+			payload: "<orders/>",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := parseOrderFile(tt.format, []byte(tt.payload))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got rows %+v, want an error", summarize(rows))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := summarize(rows); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
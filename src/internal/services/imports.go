@@ -0,0 +1,356 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"yaa/internal/domain"
+	"yaa/internal/logging"
+	"yaa/internal/validation"
+	"yaa/pkg/tracing"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxRowErrors caps the row errors stored per job; Failed still counts every
+// failed row.
+const maxRowErrors = 1000
+
+// errImportLost means another worker took the job over after our lease ran
+// out.
+var errImportLost = errors.New("import job taken over by another worker")
+
+type importsRepo interface {
+	CreateImportJob(ctx context.Context, format string, mode domain.ImportMode, payload []byte) (domain.ImportJob, error)
+	GetImportJob(ctx context.Context, id int64) (domain.ImportJob, error)
+	ClaimImportJob(ctx context.Context, lease time.Duration) (*domain.ImportJob, []byte, error)
+	SaveImportProgress(ctx context.Context, j domain.ImportJob) error
+	RenewImportLease(ctx context.Context, id int64, attempt int) error
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+	FinishImportJob(ctx context.Context, id int64, attempt int, status domain.ImportJobStatus, msg string) error
+	RequeueImportJob(ctx context.Context, id int64, attempt int) error
+}
+
+// orderImporter stores orders the way POST /orders does.
+type orderImporter interface {
+	AddOrders(ctx context.Context, feed domain.OrderFeed, mode domain.ImportMode) (domain.ImportResult, error)
+}
+
+type ImportOptions struct {
+	Workers      int
+	ChunkSize    int
+	PollInterval time.Duration
+	Lease        time.Duration
+}
+
+// ImportService imports order files in the background. Jobs live in the
+// database, so any instance may pick up a job queued by another one and a
+// job interrupted by a restart resumes after its last finished chunk.
+type ImportService struct {
+	repo   importsRepo
+	orders orderImporter
+	logger logrus.FieldLogger
+	opts   ImportOptions
+	wake   chan struct{}
+}
+
+func NewImportService(repo importsRepo, orders orderImporter, logger logrus.FieldLogger, opts ImportOptions) *ImportService {
+	return &ImportService{
+		repo:   repo,
+		orders: orders,
+		logger: logger,
+		opts:   opts,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+func (c *ImportService) SubmitOrders(ctx context.Context, format string, mode domain.ImportMode, payload []byte) (_ domain.ImportJob, err error) {
+	ctx, span := tracing.Start(ctx, "ImportService.SubmitOrders", attribute.String("format", format),
+		attribute.String("mode", string(mode)), attribute.Int("bytes", len(payload)))
+	defer func() { tracing.End(span, err) }()
+
+	job, err := c.repo.CreateImportJob(ctx, format, mode, payload)
+	if err != nil {
+		return domain.ImportJob{}, err
+	}
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+
+	logging.FromContext(ctx, c.logger).WithFields(logrus.Fields{
+		"import_id": job.Id,
+		"format":    format,
+		"bytes":     len(payload),
+	}).Info("import queued")
+	return job, nil
+}
+
+func (c *ImportService) GetImport(ctx context.Context, id int64) (_ domain.ImportJob, err error) {
+	ctx, span := tracing.Start(ctx, "ImportService.GetImport", attribute.Int64("import_id", id))
+	defer func() { tracing.End(span, err) }()
+
+	return c.repo.GetImportJob(ctx, id)
+}
+
+// Run processes import jobs with the configured number of workers until ctx
+// is done. Jobs still running then go back to the queue.
+func (c *ImportService) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < c.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (c *ImportService) work(ctx context.Context) {
+	ticker := time.NewTicker(c.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, payload, err := c.repo.ClaimImportJob(ctx, c.opts.Lease)
+		if err != nil && ctx.Err() == nil {
+			c.logger.WithError(err).Error("claim import job")
+		}
+		if job != nil {
+			c.process(ctx, *job, payload)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *ImportService) process(ctx context.Context, job domain.ImportJob, payload []byte) {
+	logger := c.logger.WithFields(logrus.Fields{"import_id": job.Id, "attempt": job.Attempts})
+	ctx = logging.WithLogger(ctx, logger)
+	ctx, span := tracing.Start(ctx, "ImportService.process", attribute.Int64("import_id", job.Id),
+		attribute.String("format", job.Format), attribute.Int("attempt", job.Attempts))
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	logger.WithField("processed", job.ProcessedRows).Info("import started")
+	jobCtx, lose := context.WithCancelCause(ctx)
+	stop := c.heartbeat(jobCtx, job, lose)
+	err = c.importRows(jobCtx, &job, payload)
+	stop()
+	if cause := context.Cause(jobCtx); errors.Is(cause, errImportLost) {
+		err = cause
+	}
+	lose(nil)
+	switch {
+	case err == nil:
+		err = c.repo.FinishImportJob(ctx, job.Id, job.Attempts, domain.JobSucceeded, "")
+		if errors.Is(err, domain.ErrConflict) {
+			logger.Warn(errImportLost.Error())
+			return
+		}
+		logger.WithFields(logrus.Fields{
+			"created": job.Created,
+			"updated": job.Updated,
+			"skipped": job.Skipped,
+			"failed":  job.Failed,
+		}).Info("import finished")
+	case errors.Is(err, errImportLost):
+		logger.Warn(err.Error())
+	case ctx.Err() != nil:
+		// Shutting down: the next worker resumes after the last saved chunk.
+		rerr := c.repo.RequeueImportJob(context.Background(), job.Id, job.Attempts)
+		if errors.Is(rerr, domain.ErrConflict) {
+			logger.Warn(errImportLost.Error())
+			return
+		}
+		if rerr != nil {
+			logger.WithError(rerr).Error("requeue import")
+		}
+		logger.WithField("processed", job.ProcessedRows).Info("import requeued")
+	default:
+		logger.WithError(err).Error("import failed")
+		if ferr := c.repo.FinishImportJob(ctx, job.Id, job.Attempts, domain.JobFailed, err.Error()); ferr != nil &&
+			!errors.Is(ferr, domain.ErrConflict) {
+			logger.WithError(ferr).Error("finish import")
+		}
+	}
+}
+
+// heartbeat renews the lease of job every third of it until stop is called,
+// so parsing a large file or storing a slow chunk does not let it run out.
+// Once another worker has claimed the job it cancels ctx with errImportLost.
+func (c *ImportService) heartbeat(ctx context.Context, job domain.ImportJob, lose context.CancelCauseFunc) (stop func()) {
+	every := c.opts.Lease / 3
+	if every <= 0 {
+		every = c.opts.Lease
+	}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := c.repo.RenewImportLease(ctx, job.Id, job.Attempts)
+			switch {
+			case errors.Is(err, domain.ErrConflict):
+				lose(fmt.Errorf("import %d: %w", job.Id, errImportLost))
+				return
+			case err != nil && ctx.Err() == nil:
+				logging.FromContext(ctx, c.logger).WithError(err).Warn("renew import lease")
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// importRows imports the rows of the file not yet processed. Each chunk is
+// stored in one transaction together with the progress after it.
+func (c *ImportService) importRows(ctx context.Context, job *domain.ImportJob, payload []byte) error {
+	rows, err := parseOrderFile(job.Format, payload)
+	if err != nil {
+		return err
+	}
+	total := len(rows)
+	job.TotalRows = &total
+	if job.Errors == nil {
+		job.Errors = []domain.RowError{}
+	}
+	if err = c.saveProgress(ctx, *job); err != nil {
+		return err
+	}
+
+	for start := job.ProcessedRows; start < total; start += c.opts.ChunkSize {
+		end := start + c.opts.ChunkSize
+		if end > total {
+			end = total
+		}
+		if err = c.importChunk(ctx, job, rows[start:end], end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ImportService) saveProgress(ctx context.Context, job domain.ImportJob) error {
+	err := c.repo.SaveImportProgress(ctx, job)
+	if errors.Is(err, domain.ErrConflict) {
+		return fmt.Errorf("import %d: %w", job.Id, errImportLost)
+	}
+	return err
+}
+
+// importChunk imports the valid rows of a chunk, records the others as row
+// errors and advances the job to row end. job only changes once the chunk
+// is stored. Only database failures are returned.
+func (c *ImportService) importChunk(ctx context.Context, job *domain.ImportJob, rows []importRow, end int) error {
+	next := *job
+	next.Errors = append([]domain.RowError{}, job.Errors...)
+
+	var sl domain.OrderSl
+	src := make([]importRow, 0, len(rows))
+	for _, r := range rows {
+		if r.err != nil {
+			next.Failed++
+			addRowError(&next, domain.RowError{Row: r.row, Id: r.order.Id, Field: r.field, Message: r.err.Error()})
+			continue
+		}
+		sl.Orders = append(sl.Orders, r.order)
+		src = append(src, r)
+	}
+
+	var verrs validation.Errors
+	if len(sl.Orders) > 0 && errors.As(validation.Orders(sl), &verrs) {
+		bad := make(map[int]bool)
+		for _, e := range verrs {
+			bad[e.Index] = true
+			addRowError(&next, domain.RowError{Row: src[e.Index].row, Id: e.Id, Field: e.Field, Message: e.Message})
+		}
+		next.Failed += len(bad)
+		sl, src = dropRows(sl, src, bad)
+	}
+
+	err := c.repo.InTx(ctx, func(ctx context.Context) error {
+		res, err := c.addOrders(ctx, sl.Orders, next.Mode)
+		var dup *domain.DuplicateError
+		if errors.As(err, &dup) {
+			bad := make(map[int]bool, len(dup.Index))
+			for k, i := range dup.Index {
+				bad[i] = true
+				addRowError(&next, domain.RowError{Row: src[i].row, Id: dup.IDs[k], Field: "id", Message: "already exists"})
+			}
+			next.Failed += len(bad)
+			sl, src = dropRows(sl, src, bad)
+			// The strict attempt rolled back to its savepoint; ids that
+			// appeared since are skipped rather than failing the chunk again.
+			res, err = c.addOrders(ctx, sl.Orders, domain.ImportSkipExisting)
+		}
+		if err != nil {
+			return err
+		}
+		next.Created += len(res.Created)
+		next.Updated += len(res.Updated)
+		next.Skipped += len(res.Skipped)
+		next.ProcessedRows = end
+		return c.repo.SaveImportProgress(ctx, next)
+	})
+	if errors.Is(err, domain.ErrConflict) {
+		// Mostly the job was taken over. An order inserted by someone else
+		// during the chunk lands here too; the job is then retried once its
+		// lease runs out.
+		return fmt.Errorf("import %d: %w", job.Id, errImportLost)
+	}
+	if err != nil {
+		return err
+	}
+	*job = next
+	return nil
+}
+
+// addOrders stores one chunk through the order service.
+func (c *ImportService) addOrders(ctx context.Context, orders []domain.Order, mode domain.ImportMode) (domain.ImportResult, error) {
+	if len(orders) == 0 {
+		return domain.NewImportResult(), nil
+	}
+	return c.orders.AddOrders(ctx, func(flush func(chunk []domain.Order) error) error {
+		return flush(orders)
+	}, mode)
+}
+
+func addRowError(job *domain.ImportJob, e domain.RowError) {
+	if len(job.Errors) < maxRowErrors {
+		job.Errors = append(job.Errors, e)
+	}
+}
+
+func dropRows(sl domain.OrderSl, src []importRow, bad map[int]bool) (domain.OrderSl, []importRow) {
+	var (
+		keep     domain.OrderSl
+		keptRows []importRow
+	)
+	for i, o := range sl.Orders {
+		if !bad[i] {
+			keep.Orders = append(keep.Orders, o)
+			keptRows = append(keptRows, src[i])
+		}
+	}
+	return keep, keptRows
+}
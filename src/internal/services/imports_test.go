@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"yaa/internal/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fakeImportsRepo keeps one job and stores orders by id, reporting the ones
+// that exist as duplicates by their index in the chunk. Like the repository it
+// fences updates by attempt, so only the latest claim may change the job, and
+// drops what a failed transaction stored.
+type fakeImportsRepo struct {
+	importsRepo
+	orders  map[int64]bool
+	mu      sync.Mutex
+	attempt int
+	saved   []domain.ImportJob
+	// renewed receives the attempt of renewed leases someone waits for.
+	renewed chan int
+	// afterCommit runs after each committed transaction.
+	afterCommit func()
+}
+
+func (f *fakeImportsRepo) ClaimImportJob(ctx context.Context, lease time.Duration) (*domain.ImportJob, []byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempt++
+	return &domain.ImportJob{Id: 1, Format: "ndjson", Mode: domain.ImportStrict, Attempts: f.attempt}, nil, nil
+}
+
+func (f *fakeImportsRepo) claimed(attempt int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if attempt != f.attempt {
+		return fmt.Errorf("attempt %d: %w", attempt, domain.ErrConflict)
+	}
+	return nil
+}
+
+func (f *fakeImportsRepo) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	orders := make(map[int64]bool, len(f.orders))
+	for id := range f.orders {
+		orders[id] = true
+	}
+	saved := len(f.saved)
+	if err := fn(ctx); err != nil {
+		f.orders, f.saved = orders, f.saved[:saved]
+		return err
+	}
+	if f.afterCommit != nil {
+		f.afterCommit()
+	}
+	return nil
+}
+
+func (f *fakeImportsRepo) SaveImportProgress(ctx context.Context, j domain.ImportJob) error {
+	if err := f.claimed(j.Attempts); err != nil {
+		return err
+	}
+	f.saved = append(f.saved, j)
+	return nil
+}
+
+func (f *fakeImportsRepo) RenewImportLease(ctx context.Context, id int64, attempt int) error {
+	if err := f.claimed(attempt); err != nil {
+		return err
+	}
+	select {
+	case f.renewed <- attempt:
+	default:
+	}
+	return nil
+}
+
+// AddOrders stands in for the order service.
+func (f *fakeImportsRepo) AddOrders(ctx context.Context, feed domain.OrderFeed, mode domain.ImportMode) (domain.ImportResult, error) {
+	res := domain.NewImportResult()
+	dup := &domain.DuplicateError{}
+	var created []int64
+	err := feed(func(chunk []domain.Order) error {
+		for i, o := range chunk {
+			switch {
+			case !f.orders[o.Id]:
+				created = append(created, o.Id)
+				res.Created = append(res.Created, o.Id)
+			case mode == domain.ImportStrict:
+				dup.Index = append(dup.Index, i)
+				dup.IDs = append(dup.IDs, o.Id)
+			default:
+				res.Skipped = append(res.Skipped, o.Id)
+			}
+		}
+		return nil
+	})
+	if err == nil && len(dup.IDs) > 0 {
+		err = dup
+	}
+	if err != nil {
+		return domain.ImportResult{}, err
+	}
+	for _, id := range created {
+		f.orders[id] = true
+	}
+	return res, nil
+}
+
+func (f *fakeImportsRepo) FinishImportJob(ctx context.Context, id int64, attempt int, status domain.ImportJobStatus,
+	msg string) error {
+	return f.claimed(attempt)
+}
+
+func ndjsonOrders(ids ...int64) []byte {
+	var b strings.Builder
+	for _, id := range ids {
+		weight := 1
+		if id < 0 {
+			id, weight = -id, 0
+		}
+		fmt.Fprintf(&b, `{"id":%d,"weight":%d,"regions":1,"cost":10,"delivery_hours":["10:00-12:00"]}`+"\n", id, weight)
+	}
+	return []byte(b.String())
+}
+
+func TestImportRows(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     domain.ImportMode
+		payload  []byte
+		existing []int64
+		want     domain.ImportJob
+		progress []int
+	}{
+		{
+			name:     "duplicates across chunks",
+			mode:     domain.ImportStrict,
+			payload:  ndjsonOrders(1, 2, 3, 4, 2, 5, 1),
+			existing: []int64{3},
+			want: domain.ImportJob{ProcessedRows: 7, Created: 4, Failed: 3, Errors: []domain.RowError{
+				{Row: 3, Id: 3, Field: "id", Message: "already exists"},
+				{Row: 5, Id: 2, Field: "id", Message: "already exists"},
+				{Row: 7, Id: 1, Field: "id", Message: "already exists"},
+			}},
+			progress: []int{0, 3, 6, 7},
+		},
+		{
+			name:    "dropped rows shift the chunk",
+			mode:    domain.ImportStrict,
+			payload: append(ndjsonOrders(1, 2, 3, -4, 2), "{\"id\":\n"...),
+			want: domain.ImportJob{ProcessedRows: 6, Created: 3, Failed: 3, Errors: []domain.RowError{
+				{Row: 6, Message: "unexpected EOF"},
+				{Row: 4, Id: 4, Field: "weight", Message: "must be in (0, 100]"},
+				{Row: 5, Id: 2, Field: "id", Message: "already exists"},
+			}},
+			progress: []int{0, 3, 6},
+		},
+		{
+			name:     "skip existing",
+			mode:     domain.ImportSkipExisting,
+			payload:  ndjsonOrders(1, 2, 3, 1),
+			existing: []int64{2},
+			want:     domain.ImportJob{ProcessedRows: 4, Created: 2, Skipped: 2, Errors: []domain.RowError{}},
+			progress: []int{0, 3, 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeImportsRepo{orders: make(map[int64]bool)}
+			for _, id := range tt.existing {
+				repo.orders[id] = true
+			}
+			c := NewImportService(repo, repo, logrus.New(), ImportOptions{ChunkSize: 3})
+			job, _, _ := repo.ClaimImportJob(context.Background(), time.Minute)
+			job.Mode = tt.mode
+			if err := c.importRows(context.Background(), job, tt.payload); err != nil {
+				t.Fatal(err)
+			}
+			total := tt.want.ProcessedRows
+			tt.want.Id, tt.want.Format, tt.want.Mode, tt.want.TotalRows = 1, "ndjson", tt.mode, &total
+			tt.want.Attempts = 1
+			if !reflect.DeepEqual(*job, tt.want) {
+				t.Errorf("got %+v\nwant %+v", job, tt.want)
+			}
+			var progress []int
+			for _, j := range repo.saved {
+				progress = append(progress, j.ProcessedRows)
+			}
+			if !reflect.DeepEqual(progress, tt.progress) {
+				t.Errorf("saved progress %v, want %v", progress, tt.progress)
+			}
+		})
+	}
+}
+
+func TestImportTakenOver(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeImportsRepo{orders: make(map[int64]bool)}
+	c := NewImportService(repo, repo, logrus.New(), ImportOptions{ChunkSize: 2})
+	job, _, _ := repo.ClaimImportJob(ctx, time.Minute)
+
+	// Our lease runs out after the first chunk and another worker claims
+	// the job.
+	repo.afterCommit = func() {
+		repo.afterCommit = nil
+		repo.ClaimImportJob(ctx, time.Minute)
+	}
+	err := c.importRows(ctx, job, ndjsonOrders(1, 2, 3, 4))
+	if !errors.Is(err, errImportLost) {
+		t.Fatalf("err = %v, want %v", err, errImportLost)
+	}
+	if job.ProcessedRows != 2 || job.Created != 2 {
+		t.Errorf("job at row %d with %d created, want the first chunk only", job.ProcessedRows, job.Created)
+	}
+	if !reflect.DeepEqual(repo.orders, map[int64]bool{1: true, 2: true}) {
+		t.Errorf("stored %v, want the first chunk only", repo.orders)
+	}
+	if err = c.repo.FinishImportJob(ctx, job.Id, job.Attempts, domain.JobSucceeded, ""); !errors.Is(err, domain.ErrConflict) {
+		t.Errorf("finishing the lost attempt: %v, want %v", err, domain.ErrConflict)
+	}
+}
+
+func TestImportHeartbeat(t *testing.T) {
+	repo := &fakeImportsRepo{renewed: make(chan int)}
+	c := NewImportService(repo, repo, logrus.New(), ImportOptions{Lease: 30 * time.Millisecond})
+	job, _, _ := repo.ClaimImportJob(context.Background(), time.Minute)
+
+	ctx, lose := context.WithCancelCause(context.Background())
+	defer lose(nil)
+	stop := c.heartbeat(ctx, *job, lose)
+	defer stop()
+
+	// The lease is renewed while the import makes no progress at all.
+	for i := 0; i < 3; i++ {
+		if attempt := <-repo.renewed; attempt != job.Attempts {
+			t.Fatalf("renewed attempt %d, want %d", attempt, job.Attempts)
+		}
+	}
+
+	repo.ClaimImportJob(context.Background(), time.Minute)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("heartbeat still running after the job was taken over")
+	}
+	if cause := context.Cause(ctx); !errors.Is(cause, errImportLost) {
+		t.Errorf("cause = %v, want %v", cause, errImportLost)
+	}
+}
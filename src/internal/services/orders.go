@@ -2,32 +2,51 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 	"yaa/internal/domain"
+	"yaa/internal/logging"
+	"yaa/internal/metrics"
+	"yaa/pkg/tracing"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ordersRepo interface {
 	GetOrder(ctx context.Context, id int64) (*domain.Order, error)
-	GetOrders(ctx context.Context, o, l int) (domain.OrderSl, error)
-	AddOrders(ctx context.Context, orders domain.OrderSl) error
-	ExistOrder(ctx context.Context, c, o int64) (bool, error)
-	SetCompliteOrders(ctx context.Context, o, c int64, str string) error
+	GetOrders(ctx context.Context, f domain.OrderFilter, p domain.PageRequest) ([]domain.Order, error)
+	CountOrders(ctx context.Context, f domain.OrderFilter) (int64, error)
+	AddOrdersFrom(ctx context.Context, feed domain.OrderFeed, mode domain.ImportMode) (domain.ImportResult, error)
+	GetOrdersByID(ctx context.Context, ids []int64) ([]domain.Order, error)
+	TransitionOrders(ctx context.Context, ts []domain.OrderTransition) ([]domain.Order, error)
+	GetOrderHistory(ctx context.Context, id int64) ([]domain.OrderStatusChange, error)
+	GetCourier(ctx context.Context, id int64) (*domain.Courier, error)
+	GetCourierTypeProfiles(ctx context.Context) (map[string]domain.CourierTypeProfile, error)
+	WithAssignmentLock(ctx context.Context, fn func(ctx context.Context) error) error
+	GetCouriersBusyUntil(ctx context.Context, date time.Time) (map[int64]time.Time, error)
+	ReassignOrder(ctx context.Context, t domain.OrderTransition, date time.Time, a domain.CourierAssignment) (domain.Order, error)
 }
 
 type OrderService struct {
 	repo   ordersRepo
 	logger logrus.FieldLogger
+	now    func() time.Time
 }
 
 func NewOrderService(repo ordersRepo, logger logrus.FieldLogger) *OrderService {
 	return &OrderService{
 		repo:   repo,
 		logger: logger,
+		now:    time.Now,
 	}
 }
 
-func (c *OrderService) GetOrder(ctx context.Context, orderID int64) (*domain.Order, error) {
+func (c *OrderService) GetOrder(ctx context.Context, orderID int64) (_ *domain.Order, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.GetOrder", attribute.Int64("order_id", orderID))
+	defer func() { tracing.End(span, err) }()
+
 	order, err := c.repo.GetOrder(ctx, orderID)
 	if err != nil {
 		return nil, err
@@ -35,33 +54,305 @@ func (c *OrderService) GetOrder(ctx context.Context, orderID int64) (*domain.Ord
 	return order, nil
 }
 
-func (c *OrderService) GetOrders(ctx context.Context, o, l int) (domain.OrderSl, error) {
-	orders, err := c.repo.GetOrders(ctx, o, l)
+func (c *OrderService) GetOrders(ctx context.Context, f domain.OrderFilter, p domain.PageRequest) (_ domain.OrderPage, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.GetOrders", attribute.Int("limit", p.Limit),
+		attribute.Bool("by_cursor", p.ByCursor), attribute.String("sort", p.Sort))
+	defer func() { tracing.End(span, err) }()
 
+	orders, err := c.repo.GetOrders(ctx, f, p)
 	if err != nil {
-		return domain.OrderSl{}, err
+		return domain.OrderPage{}, err
+	}
+
+	more := len(orders) > p.Limit
+	if more {
+		orders = orders[:p.Limit]
+	}
+	res := domain.OrderPage{Orders: orders}
+	if res.Orders == nil {
+		res.Orders = []domain.Order{}
+	}
+	var lastID int64
+	if len(orders) > 0 {
+		lastID = orders[len(orders)-1].Id
 	}
-	return orders, nil
+	res.Pagination = domain.NewPagination(p, lastID, more)
+
+	if p.WithTotal {
+		total, err := c.repo.CountOrders(ctx, f)
+		if err != nil {
+			return domain.OrderPage{}, err
+		}
+		res.Total = &total
+	}
+	return res, nil
 }
 
-func (c *OrderService) AddOrders(ctx context.Context, orders domain.OrderSl) error {
-	err := c.repo.AddOrders(ctx, orders)
+// AddOrders stores the chunks the feed hands over in one transaction.
+func (c *OrderService) AddOrders(ctx context.Context, feed domain.OrderFeed, mode domain.ImportMode) (_ domain.ImportResult, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.AddOrders", attribute.String("mode", string(mode)))
+	defer func() { tracing.End(span, err) }()
 
+	res, err := c.repo.AddOrdersFrom(ctx, feed, mode)
 	if err != nil {
+		return domain.ImportResult{}, err
+	}
+	span.SetAttributes(attribute.Int("orders", len(res.Created)+len(res.Updated)+len(res.Skipped)))
+	metrics.OrdersCreated.Add(float64(len(res.Created)))
+	logging.FromContext(ctx, c.logger).WithFields(logrus.Fields{
+		"created": len(res.Created), "updated": len(res.Updated), "skipped": len(res.Skipped),
+	}).Info("orders created")
+	return res, nil
+}
+
+// CompleteOrders completes the orders in one transaction. Repeating the
+// completion of an order by the same courier returns it unchanged.
+func (c *OrderService) CompleteOrders(ctx context.Context, ord domain.ComplOrderSl) (_ domain.OrderSl, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.CompleteOrders", attribute.Int("orders", len(ord.CompOrd)))
+	defer func() { tracing.End(span, err) }()
+
+	ids := make([]int64, 0, len(ord.CompOrd))
+	for _, v := range ord.CompOrd {
+		ids = append(ids, v.IdOrder)
+	}
+	found, err := c.repo.GetOrdersByID(ctx, ids)
+	if err != nil {
+		return domain.OrderSl{}, err
+	}
+	current := make(map[int64]domain.Order, len(found))
+	for _, o := range found {
+		current[o.Id] = o
+	}
+
+	res := make([]domain.Order, len(ord.CompOrd))
+	var (
+		ts  []domain.OrderTransition
+		pos []int
+	)
+	for i, v := range ord.CompOrd {
+		o, ok := current[v.IdOrder]
+		if !ok {
+			return domain.OrderSl{}, fmt.Errorf("order %d: %w", v.IdOrder, domain.ErrNotFound)
+		}
+		heldBy := o.CourierID != nil && *o.CourierID == v.IdCourier
+		if o.Status == domain.OrderCompleted && heldBy {
+			res[i] = o
+			continue
+		}
+		if err = o.Status.CheckTransition(domain.OrderCompleted); err != nil {
+			return domain.OrderSl{}, fmt.Errorf("order %d: %w", v.IdOrder, err)
+		}
+		if !heldBy {
+			return domain.OrderSl{}, fmt.Errorf("order %d is not assigned to courier %d: %w",
+				v.IdOrder, v.IdCourier, domain.ErrConflict)
+		}
+		if !withinHours(o.DelivHours, v.CompleteTime) {
+			return domain.OrderSl{}, fmt.Errorf("order %d: completed_time %s is outside delivery hours: %w",
+				v.IdOrder, v.CompleteTime.Format(time.RFC3339), domain.ErrValidation)
+		}
+		completedAt := v.CompleteTime
+		ts = append(ts, domain.OrderTransition{OrderID: v.IdOrder, From: o.Status, To: domain.OrderCompleted,
+			Actor: domain.ActorCourier, CourierID: o.CourierID, CompletedTime: &completedAt})
+		pos = append(pos, i)
+	}
+
+	if len(ts) > 0 {
+		done, err := c.repo.TransitionOrders(ctx, ts)
+		if err != nil {
+			return domain.OrderSl{}, err
+		}
+		for j, o := range done {
+			res[pos[j]] = o
+		}
+	}
+	metrics.OrdersCompleted.Add(float64(len(ts)))
+	logging.FromContext(ctx, c.logger).WithField("completed", len(ts)).Info("orders completed")
+	return domain.OrderSl{Orders: res}, nil
+}
+
+// CancelOrder cancels an order that is not yet on its way.
+func (c *OrderService) CancelOrder(ctx context.Context, orderID int64, req domain.OrderCancel) (_ *domain.Order, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.CancelOrder", attribute.Int64("order_id", orderID),
+		attribute.String("actor", req.Actor))
+	defer func() { tracing.End(span, err) }()
+
+	return c.transition(ctx, orderID, domain.OrderCancelled, req.Actor, nil)
+}
+
+// ReassignOrder takes an assigned or failed order away from its courier. It
+// returns to the pool for the next assignment run or, given a courier, goes
+// to that courier as a trip of its own later today.
+func (c *OrderService) ReassignOrder(ctx context.Context, orderID int64, req domain.OrderReassign) (_ *domain.Order, err error) {
+	attrs := []attribute.KeyValue{attribute.Int64("order_id", orderID), attribute.String("actor", req.Actor)}
+	if req.IdCourier != nil {
+		attrs = append(attrs, attribute.Int64("courier_id", *req.IdCourier))
+	}
+	ctx, span := tracing.Start(ctx, "OrderService.ReassignOrder", attrs...)
+	defer func() { tracing.End(span, err) }()
+
+	if req.IdCourier == nil {
+		return c.transition(ctx, orderID, domain.OrderCreated, req.Actor, nil)
+	}
+	var o *domain.Order
+	// Assignment runs place orders around the courier's trips; keep them
+	// from planning over the one added here.
+	err = c.repo.WithAssignmentLock(ctx, func(ctx context.Context) error {
+		o, err = c.reassignTo(ctx, orderID, *req.IdCourier, req.Actor)
 		return err
+	})
+	return o, err
+}
+
+// reassignTo checks that the courier is active, serves the order's region,
+// can carry it and can deliver it within both its working hours and the
+// order's delivery hours, after the trips it already has today. It runs under
+// the assignment lock.
+func (c *OrderService) reassignTo(ctx context.Context, orderID, courierID int64, actor string) (*domain.Order, error) {
+	order, err := c.repo.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err = order.Status.CheckTransition(domain.OrderCreated); err != nil {
+		return nil, fmt.Errorf("order %d: %w", orderID, err)
+	}
+	if order.Status == domain.OrderAssigned && order.CourierID != nil && *order.CourierID == courierID {
+		return nil, fmt.Errorf("order %d is already assigned to courier %d: %w", orderID, courierID, domain.ErrConflict)
+	}
+
+	courier, err := c.repo.GetCourier(ctx, courierID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, fmt.Errorf("courier %d does not exist: %w", courierID, domain.ErrValidation)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if courier.DeactivatedAt != nil {
+		return nil, fmt.Errorf("courier %d is deactivated: %w", courierID, domain.ErrConflict)
+	}
+	if !containsRegion(courier.Regions, order.Regions) {
+		return nil, fmt.Errorf("courier %d does not serve region %d: %w", courierID, order.Regions, domain.ErrConflict)
+	}
+	profiles, err := c.repo.GetCourierTypeProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	profile, ok := profiles[courier.Type]
+	if !ok {
+		return nil, fmt.Errorf("courier %d has unknown type %q", courierID, courier.Type)
+	}
+	if order.Weight > profile.MaxWeight {
+		return nil, fmt.Errorf("order %d weighs more than courier %d can carry: %w", orderID, courierID,
+			domain.ErrConflict)
+	}
+
+	now := c.now().UTC()
+	date := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	busy, err := c.repo.GetCouriersBusyUntil(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+	cursor := planFrom(date, now, busy[courierID])
+
+	windows := sortIntervals(order.DelivHours)
+	for _, work := range sortIntervals(courier.WorkHours) {
+		t := cursor
+		if t < work.Start {
+			t = work.Start
+		}
+		start, ok := earliestStart(windows, work, t, profile.FirstOrderMinutes)
+		if !ok {
+			continue
+		}
+		group := domain.DeliveryGroup{
+			Orders:     []int64{orderID},
+			StartTime:  date.Add(time.Duration(start) * time.Minute),
+			FinishTime: date.Add(time.Duration(start+profile.FirstOrderMinutes) * time.Minute),
+			Cost:       order.Cost,
+		}
+		o, err := c.repo.ReassignOrder(ctx, domain.OrderTransition{OrderID: orderID, From: order.Status,
+			To: domain.OrderCreated, Actor: actor, CourierID: order.CourierID}, date,
+			domain.CourierAssignment{IdCourier: courierID, Groups: []domain.DeliveryGroup{group}})
+		if err != nil {
+			return nil, err
+		}
+		logging.FromContext(ctx, c.logger).WithFields(logrus.Fields{"from": order.Status, "courier_id": courierID}).
+			Info("order reassigned")
+		return &o, nil
+	}
+	return nil, fmt.Errorf("courier %d cannot deliver order %d within its hours today: %w", courierID, orderID,
+		domain.ErrConflict)
+}
+
+// PickUpOrder marks an assigned order as being delivered by its courier.
+func (c *OrderService) PickUpOrder(ctx context.Context, orderID, courierID int64) (_ *domain.Order, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.PickUpOrder", attribute.Int64("order_id", orderID),
+		attribute.Int64("courier_id", courierID))
+	defer func() { tracing.End(span, err) }()
+
+	return c.transition(ctx, orderID, domain.OrderInDelivery, domain.ActorCourier, &courierID)
+}
+
+// FailOrder records that the courier could not deliver the order.
+func (c *OrderService) FailOrder(ctx context.Context, orderID, courierID int64) (_ *domain.Order, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.FailOrder", attribute.Int64("order_id", orderID),
+		attribute.Int64("courier_id", courierID))
+	defer func() { tracing.End(span, err) }()
+
+	return c.transition(ctx, orderID, domain.OrderFailed, domain.ActorCourier, &courierID)
+}
+
+func (c *OrderService) GetOrderHistory(ctx context.Context, orderID int64) (_ domain.OrderHistory, err error) {
+	ctx, span := tracing.Start(ctx, "OrderService.GetOrderHistory", attribute.Int64("order_id", orderID))
+	defer func() { tracing.End(span, err) }()
+
+	_, err = c.repo.GetOrder(ctx, orderID)
+	if err != nil {
+		return domain.OrderHistory{}, err
+	}
+	changes, err := c.repo.GetOrderHistory(ctx, orderID)
+	if err != nil {
+		return domain.OrderHistory{}, err
+	}
+	res := domain.OrderHistory{IdOrder: orderID, Changes: changes}
+	if res.Changes == nil {
+		res.Changes = []domain.OrderStatusChange{}
+	}
+	return res, nil
+}
+
+// transition moves the order to status to. A non-nil courierID must be the
+// courier holding the order.
+func (c *OrderService) transition(ctx context.Context, orderID int64, to domain.OrderStatus, actor string,
+	courierID *int64) (*domain.Order, error) {
+	order, err := c.repo.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err = order.Status.CheckTransition(to); err != nil {
+		return nil, fmt.Errorf("order %d: %w", orderID, err)
+	}
+	if courierID != nil && (order.CourierID == nil || *order.CourierID != *courierID) {
+		return nil, fmt.Errorf("order %d is not assigned to courier %d: %w", orderID, *courierID, domain.ErrConflict)
+	}
+
+	orders, err := c.repo.TransitionOrders(ctx, []domain.OrderTransition{{OrderID: orderID, From: order.Status,
+		To: to, Actor: actor, CourierID: order.CourierID}})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	logging.FromContext(ctx, c.logger).WithFields(logrus.Fields{"from": order.Status, "to": to}).Info("order status changed")
+	return &orders[0], nil
 }
 
-func (c *OrderService) CompleteOrders(ctx context.Context, ord domain.ComplOrderSl) error {
-	for _, order := range ord.CompOrd {
-		vars, err := c.repo.ExistOrder(ctx, order.IdCourier, order.IdOrder)
-		if vars && err == nil {
-			err = c.repo.SetCompliteOrders(ctx, order.IdCourier, order.IdOrder, order.CompleteTime)
-			if err != nil {
-				return err
-			}
+// withinHours reports whether t falls inside one of the delivery windows.
+// Windows are in UTC, like assignment days, whatever offset t was sent with.
+func withinHours(hours []domain.TimeInterval, t time.Time) bool {
+	t = t.UTC()
+	m := t.Hour()*60 + t.Minute()
+	for _, h := range hours {
+		if h.Contains(m) {
+			return true
 		}
 	}
-	return nil
+	return false
 }
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+	"yaa/internal/domain"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestWithinHours(t *testing.T) {
+	hours := []domain.TimeInterval{interval(t, "10:00-12:00"), interval(t, "22:00-02:00")}
+	tests := []struct {
+		at   string
+		want bool
+	}{
+		{"2023-05-01T11:00:00Z", true},
+		{"2023-05-01T14:00:00+03:00", true},
+		{"2023-05-01T05:30:00-05:30", true},
+		{"2023-05-01T11:00:00+03:00", false},
+		{"2023-05-01T12:00:00Z", true},
+		{"2023-05-01T12:01:00Z", false},
+		{"2023-05-01T23:30:00Z", true},
+		{"2023-05-02T03:30:00+02:00", true},
+		{"2023-05-01T01:30:00-01:00", false},
+	}
+	for _, tt := range tests {
+		at, err := time.Parse(time.RFC3339, tt.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := withinHours(hours, at); got != tt.want {
+			t.Errorf("withinHours(%s) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
+
+type fakeOrdersRepo struct {
+	ordersRepo
+	order    domain.Order
+	couriers map[int64]domain.Courier
+	busy     map[int64]time.Time
+
+	transitions []domain.OrderTransition
+	assignment  *domain.CourierAssignment
+	locked      bool
+}
+
+func (f *fakeOrdersRepo) GetOrder(ctx context.Context, id int64) (*domain.Order, error) {
+	if id != f.order.Id {
+		return nil, fmt.Errorf("order %d: %w", id, domain.ErrNotFound)
+	}
+	o := f.order
+	return &o, nil
+}
+
+func (f *fakeOrdersRepo) GetCourier(ctx context.Context, id int64) (*domain.Courier, error) {
+	c, ok := f.couriers[id]
+	if !ok {
+		return nil, fmt.Errorf("courier %d: %w", id, domain.ErrNotFound)
+	}
+	return &c, nil
+}
+
+func (f *fakeOrdersRepo) GetCourierTypeProfiles(ctx context.Context) (map[string]domain.CourierTypeProfile, error) {
+	return testProfiles, nil
+}
+
+func (f *fakeOrdersRepo) WithAssignmentLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	f.locked = true
+	return fn(ctx)
+}
+
+func (f *fakeOrdersRepo) GetCouriersBusyUntil(ctx context.Context, date time.Time) (map[int64]time.Time, error) {
+	return f.busy, nil
+}
+
+func (f *fakeOrdersRepo) TransitionOrders(ctx context.Context, ts []domain.OrderTransition) ([]domain.Order, error) {
+	f.transitions = append(f.transitions, ts...)
+	o := f.order
+	o.Status, o.CourierID = ts[0].To, nil
+	return []domain.Order{o}, nil
+}
+
+func (f *fakeOrdersRepo) ReassignOrder(ctx context.Context, t domain.OrderTransition, date time.Time,
+	a domain.CourierAssignment) (domain.Order, error) {
+	f.transitions = append(f.transitions, t)
+	f.assignment = &a
+	o := f.order
+	o.Status, o.CourierID = domain.OrderAssigned, &a.IdCourier
+	return o, nil
+}
+
+func TestCancelOrderRecordsActor(t *testing.T) {
+	holder := int64(1)
+	repo := &fakeOrdersRepo{order: domain.Order{Id: 7, Status: domain.OrderAssigned, CourierID: &holder}}
+	_, err := NewOrderService(repo, logrus.New()).CancelOrder(context.Background(), 7,
+		domain.OrderCancel{Actor: domain.ActorDispatcher})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.transitions) != 1 || repo.transitions[0].Actor != domain.ActorDispatcher {
+		t.Errorf("transitions %+v, want one by the dispatcher", repo.transitions)
+	}
+}
+
+func TestReassignOrder(t *testing.T) {
+	now := time.Date(2023, 5, 1, 9, 30, 0, 0, time.UTC)
+	id := func(v int64) *int64 { return &v }
+	courier := func(id int64, typ string, region int32, hours string) domain.Courier {
+		return domain.Courier{Id: id, Type: typ, Regions: []int32{region}, WorkHours: []domain.TimeInterval{interval(t, hours)}}
+	}
+	deactivated := courier(4, "BIKE", 1, "09:00-18:00")
+	deactivated.DeactivatedAt = &now
+	couriers := map[int64]domain.Courier{
+		1: courier(1, "BIKE", 1, "09:00-18:00"),
+		2: courier(2, "BIKE", 1, "09:00-18:00"),
+		3: courier(3, "BIKE", 2, "09:00-18:00"),
+		4: deactivated,
+		5: courier(5, "FOOT", 1, "09:00-18:00"),
+		6: courier(6, "BIKE", 1, "13:00-18:00"),
+	}
+	order := func(status domain.OrderStatus, weight float32) domain.Order {
+		return domain.Order{Id: 7, Status: status, CourierID: id(1), Weight: weight, Regions: 1, Cost: 100,
+			DelivHours: []domain.TimeInterval{interval(t, "10:00-12:00")}}
+	}
+
+	tests := []struct {
+		name        string
+		order       domain.Order
+		req         domain.OrderReassign
+		busy        map[int64]time.Time
+		wantErr     error
+		start, end  string
+		wantCourier *int64
+	}{
+		{name: "back to the pool", order: order(domain.OrderAssigned, 1),
+			req: domain.OrderReassign{Actor: domain.ActorDispatcher}},
+		{name: "to another courier", order: order(domain.OrderAssigned, 1),
+			req:   domain.OrderReassign{Actor: domain.ActorDispatcher, IdCourier: id(2)},
+			start: "09:48", end: "10:00", wantCourier: id(2)},
+		{name: "failed order after the courier's trips", order: order(domain.OrderFailed, 1),
+			req:   domain.OrderReassign{Actor: domain.ActorCourier, IdCourier: id(2)},
+			busy:  map[int64]time.Time{2: now.Add(time.Hour)},
+			start: "10:30", end: "10:42", wantCourier: id(2)},
+		{name: "no later than now", order: order(domain.OrderAssigned, 1),
+			req:   domain.OrderReassign{Actor: domain.ActorDispatcher, IdCourier: id(2)},
+			busy:  map[int64]time.Time{2: now.Add(-time.Hour)},
+			start: "09:48", end: "10:00", wantCourier: id(2)},
+		{name: "courier already holding it", order: order(domain.OrderAssigned, 1),
+			req: domain.OrderReassign{Actor: domain.ActorDispatcher, IdCourier: id(1)}, wantErr: domain.ErrConflict},
+		{name: "unknown courier", order: order(domain.OrderAssigned, 1),
+			req: domain.OrderReassign{Actor: domain.ActorDispatcher, IdCourier: id(99)}, wantErr: domain.ErrValidation},
+		{name: "other region", order: order(domain.OrderAssigned, 1),
+			req: domain.OrderReassign{Actor: domain.ActorDispatcher, IdCourier: id(3)}, wantErr: domain.ErrConflict},
+		{name: "deactivated courier", order: order(domain.OrderAssigned, 1),
+			req: domain.OrderReassign{Actor: domain.ActorDispatcher, IdCourier: id(4)}, wantErr: domain.ErrConflict},
+		{name: "too heavy", order: order(domain.OrderAssigned, 15),
+			req: domain.OrderReassign{Actor: domain.ActorDispatcher, IdCourier: id(5)}, wantErr: domain.ErrConflict},
+		{name: "outside working hours", order: order(domain.OrderAssigned, 1),
+			req: domain.OrderReassign{Actor: domain.ActorDispatcher, IdCourier: id(6)}, wantErr: domain.ErrConflict},
+		{name: "trips run past the delivery window", order: order(domain.OrderAssigned, 1),
+			req:  domain.OrderReassign{Actor: domain.ActorDispatcher, IdCourier: id(2)},
+			busy: map[int64]time.Time{2: now.Add(2*time.Hour + 31*time.Minute)}, wantErr: domain.ErrConflict},
+		{name: "order on its way", order: order(domain.OrderInDelivery, 1),
+			req: domain.OrderReassign{Actor: domain.ActorDispatcher, IdCourier: id(2)}, wantErr: domain.ErrConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeOrdersRepo{order: tt.order, couriers: couriers, busy: tt.busy}
+			svc := NewOrderService(repo, logrus.New())
+			svc.now = func() time.Time { return now }
+
+			o, err := svc.ReassignOrder(context.Background(), 7, tt.req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if len(repo.transitions) != 0 {
+					t.Errorf("applied %+v after an error", repo.transitions)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(repo.transitions) != 1 {
+				t.Fatalf("transitions %+v, want one", repo.transitions)
+			}
+			tr := repo.transitions[0]
+			if tr.From != tt.order.Status || tr.To != domain.OrderCreated || tr.Actor != tt.req.Actor {
+				t.Errorf("transition %+v", tr)
+			}
+			if !reflect.DeepEqual(o.CourierID, tt.wantCourier) {
+				t.Errorf("courier %v, want %v", o.CourierID, tt.wantCourier)
+			}
+			if tt.wantCourier == nil {
+				return
+			}
+			if !repo.locked {
+				t.Error("assignment lock not taken")
+			}
+			g := repo.assignment.Groups[0]
+			if got := [2]string{g.StartTime.Format("15:04"), g.FinishTime.Format("15:04")}; got != [2]string{tt.start, tt.end} {
+				t.Errorf("trip %v, want %s-%s", got, tt.start, tt.end)
+			}
+			if !reflect.DeepEqual(g.Orders, []int64{7}) || g.Cost != 100 {
+				t.Errorf("group %+v", g)
+			}
+		})
+	}
+}
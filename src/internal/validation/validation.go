@@ -0,0 +1,348 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"yaa/internal/domain"
+)
+
+const (
+	maxOrderWeight = 100
+	maxOrderCost   = 1000000
+)
+
+var courierTypes = map[string]bool{
+	"FOOT": true,
+	"BIKE": true,
+	"AUTO": true,
+}
+
+type FieldError struct {
+	Index   int    `json:"index"`
+	Id      int64  `json:"id,omitempty"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, f := range e {
+		msgs = append(msgs, fmt.Sprintf("[%d].%s: %s", f.Index, f.Field, f.Message))
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e Errors) Is(target error) bool {
+	return target == domain.ErrValidation
+}
+
+func Invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), domain.ErrValidation)
+}
+
+func Decode(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("unexpected data after JSON body")
+	}
+	return nil
+}
+
+// DecodeItems reads a JSON object whose only member is the array field and
+// hands each element to next as soon as it is read, so a large body is never
+// held in memory as a whole. A null array counts as empty.
+func DecodeItems(r io.Reader, field string, next func(dec *json.Decoder) error) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key, _ := tok.(string); key != field {
+			return fmt.Errorf("json: unknown field %q", tok)
+		}
+		tok, err = dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok == nil {
+			continue
+		}
+		if d, ok := tok.(json.Delim); !ok || d != '[' {
+			return fmt.Errorf("json: %s must be an array", field)
+		}
+		for dec.More() {
+			if err = next(dec); err != nil {
+				return err
+			}
+		}
+		if err = expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("unexpected data after JSON body")
+	}
+	return nil
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("json: expected %q, got %v", want, tok)
+	}
+	return nil
+}
+
+// intervals reports the intervals that failed to parse.
+func intervals(ivs []domain.TimeInterval, add func(msg string)) {
+	for _, iv := range ivs {
+		if err := iv.Err(); err != nil {
+			add(err.Error())
+		}
+	}
+}
+
+// Batch validates a bulk import a chunk at a time. Error indexes count from
+// the start of the batch and duplicate ids are caught across chunks.
+type Batch struct {
+	field string
+	seen  map[int64]bool
+	n     int
+	errs  Errors
+}
+
+// NewBatch starts a batch whose items are in the array field of the body.
+func NewBatch(field string) *Batch {
+	return &Batch{field: field, seen: make(map[int64]bool)}
+}
+
+// Couriers checks the next chunk and reports whether the batch is still
+// valid.
+func (b *Batch) Couriers(chunk []domain.Courier) bool {
+	for i, c := range chunk {
+		add := func(field, msg string) {
+			b.errs = append(b.errs, FieldError{Index: b.n + i, Id: c.Id, Field: field, Message: msg})
+		}
+
+		if c.Id <= 0 {
+			add("id", "must be positive")
+		} else if b.seen[c.Id] {
+			add("id", "duplicate id in batch")
+		}
+		b.seen[c.Id] = true
+
+		if !courierTypes[c.Type] {
+			add("type", "must be one of FOOT, BIKE, AUTO")
+		}
+
+		if len(c.Regions) == 0 {
+			add("regions", "must not be empty")
+		}
+		for _, r := range c.Regions {
+			if r <= 0 {
+				add("regions", fmt.Sprintf("region %d must be positive", r))
+			}
+		}
+
+		if len(c.WorkHours) == 0 {
+			add("working_hours", "must not be empty")
+		}
+		intervals(c.WorkHours, func(msg string) { add("working_hours", msg) })
+		if c.DeactivatedAt != nil {
+			add("deactivated_at", "must not be set on new couriers")
+		}
+	}
+
+	b.n += len(chunk)
+	return len(b.errs) == 0
+}
+
+// Orders checks the next chunk and reports whether the batch is still valid.
+func (b *Batch) Orders(chunk []domain.Order) bool {
+	for i, o := range chunk {
+		add := func(field, msg string) {
+			b.errs = append(b.errs, FieldError{Index: b.n + i, Id: o.Id, Field: field, Message: msg})
+		}
+
+		if o.Id <= 0 {
+			add("id", "must be positive")
+		} else if b.seen[o.Id] {
+			add("id", "duplicate id in batch")
+		}
+		b.seen[o.Id] = true
+
+		if o.Weight <= 0 || o.Weight > maxOrderWeight {
+			add("weight", fmt.Sprintf("must be in (0, %d]", maxOrderWeight))
+		}
+		if o.Cost <= 0 || o.Cost > maxOrderCost {
+			add("cost", fmt.Sprintf("must be in (0, %d]", maxOrderCost))
+		}
+		if o.Regions <= 0 {
+			add("regions", "must be positive")
+		}
+
+		if len(o.DelivHours) == 0 {
+			add("delivery_hours", "must not be empty")
+		}
+		intervals(o.DelivHours, func(msg string) { add("delivery_hours", msg) })
+		if o.CompletedTime != nil {
+			add("completed_time", "must not be set on new orders")
+		}
+		if o.Status != "" || o.CourierID != nil {
+			add("status", "must not be set on new orders")
+		}
+	}
+
+	b.n += len(chunk)
+	return len(b.errs) == 0
+}
+
+// Err returns the errors found in all chunks so far, or reports a batch
+// without items.
+func (b *Batch) Err() error {
+	if b.n == 0 {
+		return Errors{{Field: b.field, Message: "must not be empty"}}
+	}
+	if len(b.errs) > 0 {
+		return b.errs
+	}
+	return nil
+}
+
+func Couriers(sl domain.CourierSl) error {
+	b := NewBatch("couriers")
+	b.Couriers(sl.Couriers)
+	return b.Err()
+}
+
+func CourierPatch(p domain.CourierPatch) error {
+	var errs Errors
+	add := func(field, msg string) {
+		errs = append(errs, FieldError{Field: field, Message: msg})
+	}
+
+	if p.Type == nil && p.Regions == nil && p.WorkHours == nil {
+		add("body", "must change at least one of type, regions, working_hours")
+	}
+	if p.Type != nil && !courierTypes[*p.Type] {
+		add("type", "must be one of FOOT, BIKE, AUTO")
+	}
+	if p.Regions != nil {
+		if len(*p.Regions) == 0 {
+			add("regions", "must not be empty")
+		}
+		for _, r := range *p.Regions {
+			if r <= 0 {
+				add("regions", fmt.Sprintf("region %d must be positive", r))
+			}
+		}
+	}
+	if p.WorkHours != nil {
+		if len(*p.WorkHours) == 0 {
+			add("working_hours", "must not be empty")
+		}
+		intervals(*p.WorkHours, func(msg string) { add("working_hours", msg) })
+	}
+	if p.EffectiveFrom != nil {
+		if p.Type == nil {
+			add("effective_from", "only applies to a type change")
+		} else if p.EffectiveFrom.After(time.Now()) {
+			add("effective_from", "must not be in the future")
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func Orders(sl domain.OrderSl) error {
+	b := NewBatch("orders")
+	b.Orders(sl.Orders)
+	return b.Err()
+}
+
+func CompleteOrders(sl domain.ComplOrderSl) error {
+	var errs Errors
+	if len(sl.CompOrd) == 0 {
+		return Errors{{Field: "complete_orders", Message: "must not be empty"}}
+	}
+
+	now := time.Now()
+	seen := make(map[int64]bool)
+	for i, o := range sl.CompOrd {
+		add := func(field, msg string) {
+			errs = append(errs, FieldError{Index: i, Id: o.IdOrder, Field: field, Message: msg})
+		}
+
+		if o.IdCourier <= 0 {
+			add("courier_id", "must be positive")
+		}
+		if o.IdOrder <= 0 {
+			add("order_id", "must be positive")
+		} else if seen[o.IdOrder] {
+			add("order_id", "duplicate order in batch")
+		}
+		seen[o.IdOrder] = true
+
+		if o.CompleteTime.IsZero() {
+			add("completed_time", "must be an RFC 3339 timestamp")
+		} else if o.CompleteTime.After(now) {
+			add("completed_time", "must not be in the future")
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func OrderAction(a domain.OrderAction) error {
+	if a.IdCourier <= 0 {
+		return Errors{{Field: "courier_id", Message: "must be positive"}}
+	}
+	return nil
+}
+
+func OrderCancel(a domain.OrderCancel) error {
+	if a.Actor != domain.ActorClient && a.Actor != domain.ActorDispatcher {
+		return Errors{{Field: "actor", Message: "must be client or dispatcher"}}
+	}
+	return nil
+}
+
+func OrderReassign(a domain.OrderReassign) error {
+	var errs Errors
+	if a.Actor != domain.ActorCourier && a.Actor != domain.ActorDispatcher {
+		errs = append(errs, FieldError{Field: "actor", Message: "must be courier or dispatcher"})
+	}
+	if a.IdCourier != nil && *a.IdCourier <= 0 {
+		errs = append(errs, FieldError{Field: "courier_id", Message: "must be positive"})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"yaa/internal/domain"
+)
+
+func TestMalformedIntervalsAreReportedPerItem(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		target interface{}
+		check  func(v interface{}) error
+		want   Errors
+	}{
+		{
+			name: "order delivery hours",
+			body: `{"orders":[
+				{"id":1,"weight":1,"regions":1,"cost":1,"delivery_hours":["10:00-12:00"]},
+				{"id":2,"weight":1,"regions":1,"cost":1,"delivery_hours":["25:99-xx"]}]}`,
+			target: &domain.OrderSl{},
+			check:  func(v interface{}) error { return Orders(*v.(*domain.OrderSl)) },
+			want: Errors{{Index: 1, Id: 2, Field: "delivery_hours",
+				Message: `"25:99-xx" is not in HH:MM-HH:MM format`}},
+		},
+		{
+			name:   "courier working hours",
+			body:   `{"couriers":[{"id":7,"type":"FOOT","regions":[1],"working_hours":[5]}]}`,
+			target: &domain.CourierSl{},
+			check:  func(v interface{}) error { return Couriers(*v.(*domain.CourierSl)) },
+			want:   Errors{{Index: 0, Id: 7, Field: "working_hours", Message: "5 is not a string"}},
+		},
+		{
+			name:   "courier patch",
+			body:   `{"working_hours":["09:00-09:00"]}`,
+			target: &domain.CourierPatch{},
+			check:  func(v interface{}) error { return CourierPatch(*v.(*domain.CourierPatch)) },
+			want:   Errors{{Field: "working_hours", Message: `"09:00-09:00" is empty`}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := tt.target
+			if err := Decode(strings.NewReader(tt.body), v); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			err := tt.check(v)
+			var errs Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("got %v, want validation errors", err)
+			}
+			if !reflect.DeepEqual(errs, tt.want) {
+				t.Errorf("got %+v, want %+v", errs, tt.want)
+			}
+			if !errors.Is(err, domain.ErrValidation) {
+				t.Errorf("%v is not a validation error", err)
+			}
+		})
+	}
+}
+
+func TestOrderActors(t *testing.T) {
+	courier := int64(3)
+	zero := int64(0)
+	tests := []struct {
+		name  string
+		err   error
+		field string
+	}{
+		{"client cancels", OrderCancel(domain.OrderCancel{Actor: domain.ActorClient}), ""},
+		{"dispatcher cancels", OrderCancel(domain.OrderCancel{Actor: domain.ActorDispatcher}), ""},
+		{"courier cancels", OrderCancel(domain.OrderCancel{Actor: domain.ActorCourier}), "actor"},
+		{"no actor", OrderCancel(domain.OrderCancel{}), "actor"},
+		{"dispatcher returns to the pool", OrderReassign(domain.OrderReassign{Actor: domain.ActorDispatcher}), ""},
+		{"courier hands over", OrderReassign(domain.OrderReassign{Actor: domain.ActorCourier, IdCourier: &courier}), ""},
+		{"system reassigns", OrderReassign(domain.OrderReassign{Actor: domain.ActorSystem}), "actor"},
+		{"courier_id zero", OrderReassign(domain.OrderReassign{Actor: domain.ActorDispatcher, IdCourier: &zero}),
+			"courier_id"},
+	}
+	for _, tt := range tests {
+		if tt.field == "" {
+			if tt.err != nil {
+				t.Errorf("%s: %v", tt.name, tt.err)
+			}
+			continue
+		}
+		var errs Errors
+		if !errors.As(tt.err, &errs) || len(errs) != 1 || errs[0].Field != tt.field {
+			t.Errorf("%s: got %v, want an error on %s", tt.name, tt.err, tt.field)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+drop table if exists courier_type_profiles;
+drop table if exists group_orders;
+drop table if exists delivery_groups;
+drop table if exists complete_orders;
+drop table if exists orders;
+drop table if exists couriers;
+drop type if exists courier_type;
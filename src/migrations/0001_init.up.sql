@@ -0,0 +1,62 @@
+do $$
+begin
+	if not exists (select 1 from pg_type where typname = 'courier_type') then
+		create type courier_type as ENUM ('FOOT', 'BIKE', 'AUTO');
+	end if;
+end
+$$;
+
+create table if not exists couriers (
+	id BIGINT PRIMARY KEY,
+	cour_type courier_type NOT NULL,
+	regions int4[],
+	working_hours int4multirange
+);
+
+create table if not exists orders (
+	id BIGINT PRIMARY KEY UNIQUE,
+	delivery_hours int4multirange,
+	cost int,
+	regions int,
+	weight float,
+	completed_time timestamptz
+);
+
+
+CREATE TABLE if not exists complete_orders (
+    courier_id BIGINT NOT NULL REFERENCES couriers(id),
+    order_id  BIGINT NOT NULL REFERENCES orders(id) UNIQUE,
+    completed_time TIMESTAMPTZ NOT NULL
+);
+
+create table if not exists delivery_groups (
+	id BIGSERIAL PRIMARY KEY,
+	courier_id BIGINT NOT NULL REFERENCES couriers(id),
+	assign_date date NOT NULL,
+	start_time timestamptz NOT NULL,
+	finish_time timestamptz NOT NULL,
+	cost int NOT NULL
+);
+
+create table if not exists group_orders (
+	group_id BIGINT NOT NULL REFERENCES delivery_groups(id),
+	order_id BIGINT NOT NULL REFERENCES orders(id) UNIQUE,
+	position int NOT NULL
+);
+
+create table if not exists courier_type_profiles (
+	cour_type courier_type PRIMARY KEY,
+	max_weight float4 NOT NULL,
+	max_orders int NOT NULL,
+	max_regions int NOT NULL,
+	first_order_minutes int NOT NULL,
+	next_order_minutes int NOT NULL,
+	earnings_coef float4 NOT NULL,
+	rating_coef float4 NOT NULL
+);
+
+insert into courier_type_profiles values
+	('FOOT', 10, 2, 1, 25, 10, 2, 3),
+	('BIKE', 20, 4, 2, 12, 8, 3, 2),
+	('AUTO', 40, 7, 3, 8, 4, 4, 1)
+on conflict (cour_type) do nothing;
@@ -0,0 +1,13 @@
+create or replace function pg_temp.ranges_to_hours(ranges int4multirange) returns text[]
+language sql immutable as $$
+	select coalesce(array_agg(
+		to_char(make_time(lower(r) / 60, lower(r) % 60, 0), 'HH24:MI') || '-' ||
+		to_char(make_time((upper(r) % 1440) / 60, upper(r) % 60, 0), 'HH24:MI')
+		order by lower(r)), '{}')
+	from unnest(ranges) as r
+$$;
+
+alter table couriers alter column working_hours type text[]
+	using pg_temp.ranges_to_hours(working_hours);
+alter table orders alter column delivery_hours type text[]
+	using pg_temp.ranges_to_hours(delivery_hours);
@@ -0,0 +1,30 @@
+-- Converts "HH:MM-HH:MM" TEXT[] hours into int4multirange of minutes since
+-- midnight. Windows crossing midnight end past 1440. Safe to re-run.
+
+create or replace function pg_temp.hours_to_ranges(hours text[]) returns int4multirange
+language sql immutable as $$
+	select coalesce(range_agg(int4range(s, case when e <= s then e + 1440 else e end)), '{}'::int4multirange)
+	from (
+		select
+			(extract(hour from split_part(h, '-', 1)::time) * 60 + extract(minute from split_part(h, '-', 1)::time))::int as s,
+			(extract(hour from split_part(h, '-', 2)::time) * 60 + extract(minute from split_part(h, '-', 2)::time))::int as e
+		from unnest(hours) as h
+	) t
+$$;
+
+do $$
+begin
+	if exists (select 1 from information_schema.columns
+		where table_schema = current_schema()
+		and table_name = 'couriers' and column_name = 'working_hours' and udt_name = '_text') then
+		alter table couriers alter column working_hours type int4multirange
+			using pg_temp.hours_to_ranges(working_hours);
+	end if;
+	if exists (select 1 from information_schema.columns
+		where table_schema = current_schema()
+		and table_name = 'orders' and column_name = 'delivery_hours' and udt_name = '_text') then
+		alter table orders alter column delivery_hours type int4multirange
+			using pg_temp.hours_to_ranges(delivery_hours);
+	end if;
+end
+$$;
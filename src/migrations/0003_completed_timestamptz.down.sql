@@ -0,0 +1,4 @@
+alter table complete_orders alter column completed_time type timestamp
+	using completed_time at time zone 'UTC';
+alter table orders alter column completed_time type timestamp
+	using completed_time at time zone 'UTC';
@@ -0,0 +1,21 @@
+-- Stores completion times as timestamptz. Existing rows were written as UTC
+-- wall-clock values, so they are interpreted as UTC. Safe to re-run.
+
+do $$
+begin
+	if exists (select 1 from information_schema.columns
+		where table_schema = current_schema()
+		and table_name = 'complete_orders' and column_name = 'completed_time'
+		and data_type = 'timestamp without time zone') then
+		alter table complete_orders alter column completed_time type timestamptz
+			using completed_time at time zone 'UTC';
+	end if;
+	if exists (select 1 from information_schema.columns
+		where table_schema = current_schema()
+		and table_name = 'orders' and column_name = 'completed_time'
+		and data_type = 'timestamp without time zone') then
+		alter table orders alter column completed_time type timestamptz
+			using completed_time at time zone 'UTC';
+	end if;
+end
+$$;
@@ -0,0 +1,5 @@
+drop index if exists orders_delivery_hours_idx;
+drop index if exists orders_completed_time_idx;
+drop index if exists orders_regions_idx;
+drop index if exists couriers_working_hours_idx;
+drop index if exists couriers_regions_idx;
@@ -0,0 +1,8 @@
+-- Indexes backing the filters of GET /couriers and GET /orders.
+
+create index if not exists couriers_regions_idx on couriers using gin (regions);
+create index if not exists couriers_working_hours_idx on couriers using gist (working_hours);
+
+create index if not exists orders_regions_idx on orders (regions);
+create index if not exists orders_completed_time_idx on orders (completed_time);
+create index if not exists orders_delivery_hours_idx on orders using gist (delivery_hours);
@@ -0,0 +1,5 @@
+drop table if exists courier_type_history;
+
+alter table couriers
+	drop column if exists deactivated_at,
+	drop column if exists version;
@@ -0,0 +1,19 @@
+-- Adds optimistic locking and soft deactivation to couriers, and keeps the
+-- history of courier types so statistics use the type in effect when an
+-- order was completed.
+
+alter table couriers
+	add column if not exists version bigint NOT NULL DEFAULT 1,
+	add column if not exists deactivated_at timestamptz;
+
+create table if not exists courier_type_history (
+	courier_id BIGINT NOT NULL REFERENCES couriers(id),
+	cour_type courier_type NOT NULL,
+	valid_from timestamptz NOT NULL,
+	PRIMARY KEY (courier_id, valid_from)
+);
+
+-- Existing couriers have always had their current type.
+insert into courier_type_history (courier_id, cour_type, valid_from)
+select id, cour_type, '-infinity' from couriers
+on conflict do nothing;
@@ -0,0 +1,6 @@
+drop table if exists order_status_history;
+drop index if exists orders_status_idx;
+
+alter table orders drop column if exists status;
+
+drop type if exists order_status;
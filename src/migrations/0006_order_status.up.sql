@@ -0,0 +1,37 @@
+-- Gives orders an explicit lifecycle status, backfilled from the tables that
+-- used to imply it, and records every status change.
+
+do $$
+begin
+	if not exists (select 1 from pg_type where typname = 'order_status') then
+		create type order_status as ENUM ('created', 'assigned', 'in_delivery', 'completed', 'cancelled', 'failed');
+	end if;
+end
+$$;
+
+alter table orders add column if not exists status order_status NOT NULL DEFAULT 'created';
+
+update orders set status = 'completed'
+where completed_time is not null and status = 'created';
+update orders o set status = 'assigned'
+from group_orders g
+where g.order_id = o.id and o.status = 'created';
+
+create index if not exists orders_status_idx on orders (status);
+
+create table if not exists order_status_history (
+	id BIGSERIAL PRIMARY KEY,
+	order_id BIGINT NOT NULL REFERENCES orders(id),
+	from_status order_status,
+	to_status order_status NOT NULL,
+	actor text NOT NULL,
+	courier_id BIGINT REFERENCES couriers(id),
+	request_id text,
+	changed_at timestamptz NOT NULL DEFAULT now()
+);
+
+create index if not exists order_status_history_order_idx on order_status_history (order_id, id);
+
+insert into order_status_history (order_id, to_status, actor)
+select o.id, o.status, 'system' from orders o
+where not exists (select 1 from order_status_history h where h.order_id = o.id);
@@ -0,0 +1 @@
+drop table if exists import_jobs;
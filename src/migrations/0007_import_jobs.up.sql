@@ -0,0 +1,27 @@
+-- Asynchronous order imports. The uploaded file is kept with its job until
+-- the job finishes, so any instance can pick it up and, once the lease of a
+-- crashed worker runs out, resume it after the last finished chunk.
+
+create table if not exists import_jobs (
+	id BIGSERIAL PRIMARY KEY,
+	format text NOT NULL,
+	mode text NOT NULL,
+	status text NOT NULL DEFAULT 'queued',
+	attempts int NOT NULL DEFAULT 0,
+	payload bytea NOT NULL,
+	total_rows int,
+	processed_rows int NOT NULL DEFAULT 0,
+	created_rows int NOT NULL DEFAULT 0,
+	updated_rows int NOT NULL DEFAULT 0,
+	skipped_rows int NOT NULL DEFAULT 0,
+	failed_rows int NOT NULL DEFAULT 0,
+	row_errors jsonb NOT NULL DEFAULT '[]',
+	error text,
+	created_at timestamptz NOT NULL DEFAULT now(),
+	started_at timestamptz,
+	finished_at timestamptz,
+	heartbeat_at timestamptz
+);
+
+create index if not exists import_jobs_pending_idx on import_jobs (id)
+where status in ('queued', 'running');
@@ -2,15 +2,39 @@ package postgres
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-func NewPool(dsn string) (*pgxpool.Pool, error) {
-	poolConfig, err := pgxpool.ParseConfig(dsn)
+type Config struct {
+	DSN             string
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+	// SearchPath overrides the schema search path of every connection.
+	SearchPath string
+}
+
+func NewPool(cfg Config) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(cfg.DSN)
 	if err != nil {
 		return nil, err
 	}
+	if cfg.MaxConns > 0 {
+		poolConfig.MaxConns = cfg.MaxConns
+	}
+	poolConfig.MinConns = cfg.MinConns
+	if cfg.SearchPath != "" {
+		poolConfig.ConnConfig.RuntimeParams["search_path"] = cfg.SearchPath
+	}
+	if cfg.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
 
 	pool, err := pgxpool.ConnectConfig(context.Background(), poolConfig)
 
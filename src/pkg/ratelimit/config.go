@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Policy struct {
+	Name    string   `yaml:"name"`
+	Methods []string `yaml:"methods"`
+	Routes  []string `yaml:"routes"`
+	Rate    float64  `yaml:"rate"`
+	Burst   int      `yaml:"burst"`
+}
+
+type Config struct {
+	// Key selects how clients are identified: "ip", "api_key" or
+	// "header:<Name>". Requests without the header fall back to the IP.
+	Key string `yaml:"key"`
+	// TrustProxy identifies clients by the address the proxy in front of
+	// the service appended to X-Forwarded-For.
+	TrustProxy bool          `yaml:"trust_proxy"`
+	IdleTTL    time.Duration `yaml:"idle_ttl"`
+	Default    Policy        `yaml:"default"`
+	Policies   []Policy      `yaml:"policies"`
+	Exempt     []string      `yaml:"exempt"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Key:     "ip",
+		IdleTTL: 10 * time.Minute,
+		Default: Policy{Name: "default", Rate: 10, Burst: 20},
+		Exempt:  []string{"/healthz", "/readyz", "/metrics"},
+		Policies: []Policy{
+			{
+				Name:    "bulk",
+				Methods: []string{"POST"},
+				Routes:  []string{"/couriers", "/orders", "/imports/orders"},
+				Rate:    1,
+				Burst:   5,
+			},
+		},
+	}
+}
+
+func (c Config) Validate() error {
+	if c.Key != "ip" && c.Key != "api_key" && !strings.HasPrefix(c.Key, "header:") {
+		return fmt.Errorf("rate limit key %q must be ip, api_key or header:<Name>", c.Key)
+	}
+	if c.IdleTTL <= 0 {
+		return fmt.Errorf("rate limit idle_ttl must be positive")
+	}
+	for _, p := range append([]Policy{c.Default}, c.Policies...) {
+		if p.Name == "" {
+			return fmt.Errorf("rate limit policy must have a name")
+		}
+		if p.Rate <= 0 || p.Burst <= 0 {
+			return fmt.Errorf("rate limit policy %q must have positive rate and burst", p.Name)
+		}
+	}
+	return nil
+}
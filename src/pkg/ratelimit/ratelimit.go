@@ -0,0 +1,171 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/time/rate"
+)
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type Limiter struct {
+	// Rejected, if set, is called with the policy name of every rejected request.
+	Rejected func(policy string)
+
+	cfg     Config
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func New(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:     cfg,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeOf(r)
+		if len(l.cfg.Exempt) > 0 && matches(l.cfg.Exempt, route) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		policy := l.policy(r.Method, route)
+		lim := l.bucket(policy, l.clientKey(r), now)
+
+		allowed := lim.AllowN(now, 1)
+		tokens := lim.TokensAt(now)
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(policy.Burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(math.Max(0, math.Floor(tokens)))))
+
+		if !allowed {
+			if l.Rejected != nil {
+				l.Rejected(policy.Name)
+			}
+			wait := math.Ceil((1 - tokens) / policy.Rate)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, wait))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Run evicts buckets idle for longer than the configured TTL until ctx is done.
+func (l *Limiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.cfg.IdleTTL / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.evict(now)
+		}
+	}
+}
+
+func (l *Limiter) evict(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > l.cfg.IdleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *Limiter) bucket(policy Policy, client string, now time.Time) *rate.Limiter {
+	key := policy.Name + "|" + client
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(policy.Rate), policy.Burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter
+}
+
+func routeOf(r *http.Request) string {
+	if cur := mux.CurrentRoute(r); cur != nil {
+		if tpl, err := cur.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return r.URL.Path
+}
+
+func (l *Limiter) policy(method, route string) Policy {
+	for _, p := range l.cfg.Policies {
+		if matches(p.Methods, method) && matches(p.Routes, route) {
+			return p
+		}
+	}
+	return l.cfg.Default
+}
+
+func matches(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, x := range values {
+		if strings.EqualFold(x, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Limiter) clientKey(r *http.Request) string {
+	header := ""
+	switch {
+	case l.cfg.Key == "api_key":
+		header = "X-API-Key"
+	case strings.HasPrefix(l.cfg.Key, "header:"):
+		header = strings.TrimPrefix(l.cfg.Key, "header:")
+	}
+	if header != "" {
+		if v := r.Header.Get(header); v != "" {
+			return "key:" + v
+		}
+	}
+	return "ip:" + l.clientIP(r)
+}
+
+// clientIP returns the address the request came from. Behind a trusted proxy
+// that is the last X-Forwarded-For entry, the one the proxy appended; the
+// entries before it are whatever the client sent.
+func (l *Limiter) clientIP(r *http.Request) string {
+	if l.cfg.TrustProxy {
+		fwd := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		if last := strings.TrimSpace(fwd[len(fwd)-1]); last != "" {
+			return last
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
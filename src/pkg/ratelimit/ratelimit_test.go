@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testConfig() Config {
+	return Config{
+		Key:     "ip",
+		IdleTTL: time.Minute,
+		Default: Policy{Name: "default", Rate: 0.5, Burst: 2},
+		Policies: []Policy{
+			{Name: "bulk", Methods: []string{"POST"}, Routes: []string{"/orders"}, Rate: 1, Burst: 1},
+		},
+		Exempt: []string{"/healthz"},
+	}
+}
+
+func serve(l *Limiter, method, path, remote, forwarded string) *httptest.ResponseRecorder {
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = remote
+	if forwarded != "" {
+		req.Header.Set("X-Forwarded-For", forwarded)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestHeaders(t *testing.T) {
+	var rejected []string
+	l := New(testConfig())
+	l.Rejected = func(policy string) { rejected = append(rejected, policy) }
+
+	tests := []struct {
+		method, path string
+		status       int
+		remaining    string
+		retryAfter   string
+	}{
+		{"GET", "/couriers", http.StatusOK, "1", ""},
+		{"GET", "/couriers", http.StatusOK, "0", ""},
+		{"GET", "/couriers", http.StatusTooManyRequests, "0", "2"},
+		{"POST", "/orders", http.StatusOK, "0", ""},
+		{"POST", "/orders", http.StatusTooManyRequests, "0", "1"},
+		{"GET", "/healthz", http.StatusOK, "", ""},
+	}
+	for i, tt := range tests {
+		w := serve(l, tt.method, tt.path, "10.0.0.1:1234", "")
+		if w.Code != tt.status {
+			t.Errorf("%d: status %d, want %d", i, w.Code, tt.status)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != tt.remaining {
+			t.Errorf("%d: X-RateLimit-Remaining %q, want %q", i, got, tt.remaining)
+		}
+		if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+			t.Errorf("%d: Retry-After %q, want %q", i, got, tt.retryAfter)
+		}
+	}
+	if got := serve(l, "POST", "/orders", "10.0.0.2:1", "").Header().Get("X-RateLimit-Limit"); got != "1" {
+		t.Errorf("bulk X-RateLimit-Limit %q, want 1", got)
+	}
+	if len(rejected) != 2 || rejected[0] != "default" || rejected[1] != "bulk" {
+		t.Errorf("rejected policies %v, want [default bulk]", rejected)
+	}
+}
+
+func TestForwardedFor(t *testing.T) {
+	tests := []struct {
+		name          string
+		trustProxy    bool
+		first, second string
+		want          int
+	}{
+		{"ignored unless trusted", false, "203.0.113.1", "203.0.113.2", http.StatusTooManyRequests},
+		{"separates clients behind a trusted proxy", true, "203.0.113.1", "203.0.113.2", http.StatusOK},
+		{"entries sent by the client are ignored", true, "198.51.100.1, 203.0.113.1", "198.51.100.2, 203.0.113.1",
+			http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.TrustProxy = tt.trustProxy
+			l := New(cfg)
+			serve(l, "POST", "/orders", "10.0.0.1:1", tt.first)
+			w := serve(l, "POST", "/orders", "10.0.0.1:1", tt.second)
+			if w.Code != tt.want {
+				t.Errorf("second client got %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvict(t *testing.T) {
+	l := New(testConfig())
+	now := time.Now()
+	l.bucket(l.cfg.Default, "ip:a", now)
+	l.bucket(l.cfg.Default, "ip:b", now.Add(30*time.Second))
+
+	l.evict(now.Add(time.Minute))
+	if len(l.buckets) != 2 {
+		t.Fatalf("evicted a bucket idle for exactly the TTL: %v", l.buckets)
+	}
+	l.evict(now.Add(time.Minute + time.Second))
+	if _, ok := l.buckets["default|ip:a"]; ok || len(l.buckets) != 1 {
+		t.Errorf("buckets after eviction: %v, want only ip:b", l.buckets)
+	}
+
+	// An evicted client starts again with a full bucket.
+	lim := l.bucket(l.cfg.Default, "ip:a", now.Add(2*time.Minute))
+	if got := lim.TokensAt(now.Add(2 * time.Minute)); got != 2 {
+		t.Errorf("tokens of a new bucket = %v, want 2", got)
+	}
+}
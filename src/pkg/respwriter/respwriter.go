@@ -0,0 +1,33 @@
+// Package respwriter wraps http.ResponseWriter to remember the status code of
+// the response, for middleware that reports on finished requests.
+package respwriter
+
+import "net/http"
+
+type Writer struct {
+	http.ResponseWriter
+	status int
+}
+
+// Wrap returns w as a *Writer. A writer already wrapped by an outer
+// middleware is reused, so stacked middleware share one wrapper.
+func Wrap(w http.ResponseWriter) *Writer {
+	if sw, ok := w.(*Writer); ok {
+		return sw
+	}
+	return &Writer{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (w *Writer) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Status is the status code written so far, 200 if none was set explicitly.
+func (w *Writer) Status() int {
+	return w.status
+}
+
+func (w *Writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}